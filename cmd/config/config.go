@@ -0,0 +1,49 @@
+package config
+
+import (
+	"github.com/byFrederick/branch-sweeper/cmd/flags"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+type cmdOptions struct {
+	paths    []string
+	discover sweeper.DiscoverOptions
+	output   string
+}
+
+var Cmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration files",
+}
+
+var showCmd = &cobra.Command{
+	Use:     "show",
+	Short:   "Show the effective settings of every repository",
+	Example: "branch-sweeper config show --path ~/",
+	Run: func(cmd *cobra.Command, args []string) {
+		options := getOptions(cmd)
+		showConfig(cmd, options)
+	},
+}
+
+func getOptions(cmd *cobra.Command) cmdOptions {
+	paths, discover, err := flags.Discovery(cmd)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+
+	return cmdOptions{
+		paths:    paths,
+		discover: discover,
+		output:   output,
+	}
+}
+
+func init() {
+	Cmd.AddCommand(showCmd)
+}
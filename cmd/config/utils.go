@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	sweeperconfig "github.com/byFrederick/branch-sweeper/pkg/config"
+	"github.com/byFrederick/branch-sweeper/pkg/output"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// repoSettings are the effective settings of a repository and the sources they were read from
+type repoSettings struct {
+	Repository             string `json:"repository" yaml:"repository"`
+	sweeperconfig.Settings `yaml:",inline"`
+	Sources                []string `json:"sources" yaml:"sources"`
+}
+
+func showConfig(cmd *cobra.Command, options cmdOptions) {
+	cfg, err := sweeperconfig.New(cmd.Flags())
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repoPaths, err := sweeper.DiscoverRepositories(options.paths, options.discover)
+
+	if err != nil {
+		log.Warn(err)
+	}
+
+	repos := []repoSettings{}
+
+	for _, repoPath := range repoPaths {
+		settings, sources, err := cfg.Resolve(repoPath)
+
+		if err != nil {
+			log.Warn(err)
+			continue
+		}
+
+		repos = append(repos, repoSettings{Repository: repoPath, Settings: settings, Sources: sources})
+	}
+
+	switch options.output {
+	case output.JSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(repos)
+	case output.YAML:
+		err = yaml.NewEncoder(os.Stdout).Encode(repos)
+	case output.Table:
+		printSettings(repos)
+	default:
+		log.Fatalf("Output format %s is not supported by config show (supported: table, json, yaml)", options.output)
+	}
+
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// printSettings prints the effective settings of every repository
+func printSettings(repos []repoSettings) {
+	if len(repos) == 0 {
+		fmt.Println("No repositories found")
+		return
+	}
+
+	for i, repo := range repos {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		days := ""
+
+		if repo.Days != nil {
+			days = strconv.Itoa(*repo.Days)
+		}
+
+		fmt.Println(repo.Repository)
+		fmt.Printf("  %-10s %s\n", "base:", strings.Join(repo.Base, ", "))
+		fmt.Printf("  %-10s %s\n", "days:", days)
+		fmt.Printf("  %-10s %s\n", "include:", strings.Join(slices.Concat(repo.Include, repo.IncludeRegex), ", "))
+		fmt.Printf("  %-10s %s\n", "exclude:", strings.Join(slices.Concat(repo.Exclude, repo.ExcludeRegex), ", "))
+		fmt.Printf("  %-10s %s\n", "protected:", strings.Join(repo.Protected, ", "))
+		fmt.Printf("  %-10s %s\n", "remote:", repo.Remote)
+		fmt.Printf("  %-10s %s\n", "sources:", strings.Join(repo.Sources, ", "))
+	}
+}
@@ -0,0 +1,117 @@
+package flags
+
+import (
+	"os"
+	"time"
+
+	"github.com/byFrederick/branch-sweeper/pkg/config"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/spf13/cobra"
+)
+
+// Discovery returns the paths searched for repositories and the discovery options set by the global flags
+// The repositories of --repos-from are read from stdin when it is "-"
+func Discovery(cmd *cobra.Command) ([]string, sweeper.DiscoverOptions, error) {
+	paths, _ := cmd.Flags().GetStringArray("path")
+	nested, _ := cmd.Flags().GetBool("recurse-nested")
+	submodules, _ := cmd.Flags().GetBool("submodules")
+	maxDepth, _ := cmd.Flags().GetInt("max-depth")
+	followSymlinks, _ := cmd.Flags().GetBool("follow-symlinks")
+	oneFilesystem, _ := cmd.Flags().GetBool("one-filesystem")
+	reposFrom, _ := cmd.Flags().GetString("repos-from")
+
+	repositories, err := sweeper.ReadRepositories(reposFrom, os.Stdin)
+
+	if err != nil {
+		return nil, sweeper.DiscoverOptions{}, err
+	}
+
+	discover := sweeper.DiscoverOptions{
+		RecurseNested:  nested,
+		Submodules:     submodules,
+		MaxDepth:       maxDepth,
+		FollowSymlinks: followSymlinks,
+		OneFilesystem:  oneFilesystem,
+		Repositories:   repositories,
+	}
+
+	return paths, discover, nil
+}
+
+// SweeperOptions returns the options shared by the list and prune commands, set by the global flags,
+// the repository settings are resolved from the configuration files
+func SweeperOptions(cmd *cobra.Command) (sweeper.SweeperOptions, error) {
+	days, _ := cmd.Flags().GetInt("days")
+	olderThanAge, _ := cmd.Flags().GetString("older-than")
+	newerThanAge, _ := cmd.Flags().GetString("newer-than")
+	dateSource, _ := cmd.Flags().GetString("date-source")
+	merged, _ := cmd.Flags().GetBool("merged")
+	detection, _ := cmd.Flags().GetString("merge-detection")
+	base, _ := cmd.Flags().GetStringArray("base")
+	mergedAll, _ := cmd.Flags().GetBool("merged-into-all")
+	baseFallback, _ := cmd.Flags().GetStringArray("base-fallback")
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	includeRegex, _ := cmd.Flags().GetStringArray("include-regex")
+	excludeRegex, _ := cmd.Flags().GetStringArray("exclude-regex")
+	authors, _ := cmd.Flags().GetStringArray("author")
+	committers, _ := cmd.Flags().GetStringArray("committer")
+	authorsNot, _ := cmd.Flags().GetStringArray("author-not")
+	scope, _ := cmd.Flags().GetString("identity-scope")
+	protected, _ := cmd.Flags().GetStringArray("protected")
+	noDefaults, _ := cmd.Flags().GetBool("no-default-protected")
+	jobs, _ := cmd.Flags().GetInt("jobs")
+	remoteName, _ := cmd.Flags().GetString("remote-name")
+	tracking, _ := cmd.Flags().GetBool("remote-tracking")
+
+	paths, discover, err := Discovery(cmd)
+
+	if err != nil {
+		return sweeper.SweeperOptions{}, err
+	}
+
+	olderThan, newerThan, days, err := sweeper.ParseAgeWindow(olderThanAge, newerThanAge, days, cmd.Flags().Changed("days"), time.Now())
+
+	if err != nil {
+		return sweeper.SweeperOptions{}, err
+	}
+
+	cfg, err := config.New(cmd.Flags())
+
+	if err != nil {
+		return sweeper.SweeperOptions{}, err
+	}
+
+	// The stale days default to 0 with --newer-than alone, configuration files may still set them
+	cfg.Defaults.Days = &days
+
+	options := sweeper.SweeperOptions{
+		Paths:              paths,
+		Discover:           discover,
+		StaleDays:          days,
+		OlderThan:          olderThan,
+		NewerThan:          newerThan,
+		DateSource:         sweeper.DateSource(dateSource),
+		Merged:             merged,
+		MergeDetection:     sweeper.MergeDetection(detection),
+		BaseBranches:       sweeper.SplitPatterns(base),
+		MergedIntoAll:      mergedAll,
+		BaseFallback:       sweeper.SplitPatterns(baseFallback),
+		Include:            include,
+		Exclude:            exclude,
+		IncludeRegex:       includeRegex,
+		ExcludeRegex:       excludeRegex,
+		Authors:            authors,
+		Committers:         committers,
+		AuthorsNot:         authorsNot,
+		IdentityScope:      sweeper.IdentityScope(scope),
+		Protected:          sweeper.SplitPatterns(protected),
+		NoDefaultProtected: noDefaults,
+		Jobs:               jobs,
+		RepoOptions:        cfg.RepoOptions,
+		RemoteName:         remoteName,
+		RemoteTracking:     tracking,
+	}
+
+	return options, nil
+}
@@ -0,0 +1,40 @@
+package history
+
+import (
+	"github.com/byFrederick/branch-sweeper/cmd/flags"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+type cmdOptions struct {
+	paths    []string
+	discover sweeper.DiscoverOptions
+	output   string
+}
+
+var Cmd = &cobra.Command{
+	Use:     "history",
+	Short:   "List prune runs that can be undone",
+	Example: "branch-sweeper history --path ~/",
+	Run: func(cmd *cobra.Command, args []string) {
+		options := getOptions(cmd)
+		listHistory(options)
+	},
+}
+
+func getOptions(cmd *cobra.Command) cmdOptions {
+	paths, discover, err := flags.Discovery(cmd)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+
+	return cmdOptions{
+		paths:    paths,
+		discover: discover,
+		output:   output,
+	}
+}
@@ -0,0 +1,52 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byFrederick/branch-sweeper/pkg/output"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+)
+
+func listHistory(options cmdOptions) {
+	journals, err := sweeper.History(options.paths, options.discover)
+
+	if options.output != output.Table {
+		reports := []sweeper.BranchReport{}
+
+		for _, journal := range journals {
+			reports = append(reports, journal.Reports()...)
+		}
+
+		if err := output.Write(os.Stdout, options.output, reports); err != nil {
+			log.Error(err)
+		}
+	} else if len(journals) > 0 {
+		fmt.Printf("%-30s %-20s %-30s %-10s %-10s\n", "Run", "Date", "Repository", "Branches", "Status")
+
+		for _, journal := range journals {
+			status := "deleted"
+
+			if journal.RestoredAt != nil {
+				status = "restored"
+			}
+
+			fmt.Printf(
+				"%-30s %-20s %-30s %-10d %-10s\n",
+				journal.RunID,
+				journal.CreatedAt.Local().Format(time.DateTime),
+				journal.RepoName,
+				len(journal.Reports()),
+				status,
+			)
+		}
+	} else {
+		fmt.Println("No prune runs found")
+	}
+
+	if err != nil {
+		log.Warn(err)
+	}
+}
@@ -1,16 +1,15 @@
 package list
 
 import (
+	"github.com/byFrederick/branch-sweeper/cmd/flags"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
 )
 
 type cmdOptions struct {
-	path       string
-	staleDays  int
-	merged     bool
-	baseBranch string
-	include    string
-	exclude    string
+	sweeper sweeper.SweeperOptions
+	output  string
 }
 
 var Cmd = &cobra.Command{
@@ -25,20 +24,17 @@ var Cmd = &cobra.Command{
 }
 
 func getOptions(cmd *cobra.Command) cmdOptions {
-	path, _ := cmd.Flags().GetString("path")
-	days, _ := cmd.Flags().GetInt("days")
-	merged, _ := cmd.Flags().GetBool("merged")
-	base, _ := cmd.Flags().GetString("base")
-	include, _ := cmd.Flags().GetString("include")
-	exclude, _ := cmd.Flags().GetString("exclude")
+	output, _ := cmd.Flags().GetString("output")
+
+	sweeperOptions, err := flags.SweeperOptions(cmd)
+
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	return cmdOptions{
-		path:       path,
-		staleDays:  days,
-		merged:     merged,
-		baseBranch: base,
-		include:    include,
-		exclude:    exclude,
+		sweeper: sweeperOptions,
+		output:  output,
 	}
 }
 
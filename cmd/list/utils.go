@@ -2,32 +2,30 @@ package list
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/byFrederick/branch-sweeper/pkg/output"
 	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
 	"github.com/charmbracelet/log"
 )
 
 func listBranches(options cmdOptions) {
-	repoBranches, err := sweeper.Sweeper(
-		sweeper.SweeperOptions{
-			Path:       options.path,
-			StaleDays:  options.staleDays,
-			Merged:     options.merged,
-			BaseBranch: options.baseBranch,
-			Include:    options.include,
-			Exclude:    options.exclude,
-		},
-	)
-
-	if len(repoBranches) > 0 {
-		fmt.Printf("%-40s %-40s\n", "Repository", "Branch")
-
-		for _, entries := range repoBranches {
-			for _, entry := range entries {
-				fmt.Printf("%-41s", entry)
-			}
-			fmt.Print("\n")
+	sweeperOptions := options.sweeper
+
+	if err := sweeperOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	repoBranches, err := sweeper.Sweeper(sweeperOptions)
+
+	if options.output != output.Table {
+		if err := output.Write(os.Stdout, options.output, repoBranches); err != nil {
+			log.Error(err)
 		}
+	} else if len(repoBranches) > 0 {
+		printTable(repoBranches, showBase(sweeperOptions.BaseBranches, repoBranches), sweeperOptions.DateSource != sweeper.DateSourceAuthor)
 	} else {
 		fmt.Println("No branches found")
 	}
@@ -36,3 +34,54 @@ func listBranches(options cmdOptions) {
 		log.Warn(err)
 	}
 }
+
+// showBase reports whether the base branch may differ between branches, i.e. it is detected, matched by several patterns
+// or set per repository by configuration files
+func showBase(baseBranches []string, reports []sweeper.BranchReport) bool {
+	for _, report := range reports {
+		if report.BaseBranch != reports[0].BaseBranch {
+			return true
+		}
+	}
+
+	return len(baseBranches) != 1 || baseBranches[0] == sweeper.BaseBranchAuto || strings.ContainsAny(baseBranches[0], "*?[{")
+}
+
+// printTable prints the reports as a fixed-width table
+// The base branch column is only shown when it may differ between branches,
+// the last update column when it doesn't come from the author date
+func printTable(reports []sweeper.BranchReport, showBase bool, showDate bool) {
+	header := fmt.Sprintf("%-40s %-40s", "Repository", "Branch")
+
+	if showBase {
+		header += fmt.Sprintf(" %-20s", "Base")
+	}
+
+	if showDate {
+		header += fmt.Sprintf(" %-34s", "Last update")
+	}
+
+	fmt.Println(header)
+
+	for _, report := range reports {
+		line := fmt.Sprintf("%-41s%-41s", report.RepoName, report.BranchName())
+
+		if showBase {
+			line += fmt.Sprintf("%-21s", report.BaseBranch)
+		}
+
+		if showDate {
+			line += fmt.Sprintf("%-35s", fmt.Sprintf("%s (%s)", report.LastCommit.Format(time.DateOnly), report.DateSource))
+		}
+
+		if report.Action == sweeper.ActionSkipped {
+			line += " skipped: " + report.SkipReason
+		}
+
+		if report.SkipReason == sweeper.SkipUnpushed {
+			line += fmt.Sprintf(" (%d)", report.UnpushedCommits)
+		}
+
+		fmt.Println(line)
+	}
+}
@@ -1,24 +1,23 @@
 package prune
 
 import (
+	"github.com/byFrederick/branch-sweeper/cmd/flags"
+	"github.com/byFrederick/branch-sweeper/pkg/prompt"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
 )
 
 type cmdOptions struct {
-	path       string
-	staleDays  int
-	merged     bool
-	baseBranch string
-	include    string
-	exclude    string
-	remote     bool
-	remoteName string
+	sweeper sweeper.SweeperOptions
+	output  string
+	yes     bool
 }
 
 var Cmd = &cobra.Command{
-	Use:   "prune",
-	Short: "Delete stale branches",
-	// Example: "",
+	Use:     "prune",
+	Short:   "Delete stale branches",
+	Example: "branch-sweeper prune --merged --days 90 --dry-run --path ~/",
 	Run: func(cmd *cobra.Command, args []string) {
 		options := getOptions(cmd)
 		pruneBranches(options)
@@ -26,24 +25,31 @@ var Cmd = &cobra.Command{
 }
 
 func getOptions(cmd *cobra.Command) cmdOptions {
-	path, _ := cmd.Flags().GetString("path")
-	days, _ := cmd.Flags().GetInt("days")
-	merged, _ := cmd.Flags().GetBool("merged")
-	base, _ := cmd.Flags().GetString("base")
-	include, _ := cmd.Flags().GetString("include")
-	exclude, _ := cmd.Flags().GetString("exclude")
+	output, _ := cmd.Flags().GetString("output")
 	remote, _ := cmd.Flags().GetBool("remote")
-	remoteName, _ := cmd.Flags().GetString("remote-name")
+	sshKey, _ := cmd.Flags().GetString("ssh-key")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+	force, _ := cmd.Flags().GetBool("force")
+
+	sweeperOptions, err := flags.SweeperOptions(cmd)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sweeperOptions.Remote = remote
+	sweeperOptions.DryRun = dryRun
+	sweeperOptions.Force = force
+	sweeperOptions.Auth = sweeper.AuthOptions{
+		SSHKeyFile: sshKey,
+		Passphrase: prompt.Passphrase,
+	}
 
 	return cmdOptions{
-		path:       path,
-		staleDays:  days,
-		merged:     merged,
-		baseBranch: base,
-		include:    include,
-		exclude:    exclude,
-		remote:     remote,
-		remoteName: remoteName,
+		sweeper: sweeperOptions,
+		output:  output,
+		yes:     yes,
 	}
 }
 
@@ -52,12 +58,26 @@ func init() {
 		"remote",
 		"r",
 		false,
-		"Delete matching branch on the remote repository (requires your SSH public key loaded in ssh-agent for auth)",
+		"Delete the upstream of matching branches on their remote (branch.<name>.remote and branch.<name>.merge)",
+	)
+
+	Cmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Show the branches that would be deleted without deleting them",
 	)
 
-	Cmd.Flags().String(
-		"remote-name",
-		"origin",
-		"Name of Git remote",
+	Cmd.Flags().BoolP(
+		"force",
+		"f",
+		false,
+		"Delete branches even if they have commits not reachable from any remote-tracking branch or base branch",
+	)
+
+	Cmd.Flags().BoolP(
+		"yes",
+		"y",
+		false,
+		"Delete without asking for confirmation (required when stdin is not a terminal)",
 	)
 }
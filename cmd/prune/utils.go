@@ -1,31 +1,55 @@
 package prune
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
+	"github.com/byFrederick/branch-sweeper/pkg/output"
 	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
 	"github.com/charmbracelet/log"
+	"github.com/mattn/go-isatty"
 )
 
 func pruneBranches(options cmdOptions) {
-	prunedBranches, err := sweeper.Sweeper(
-		sweeper.SweeperOptions{
-			Path:       options.path,
-			StaleDays:  options.staleDays,
-			Merged:     options.merged,
-			BaseBranch: options.baseBranch,
-			Prune:      true,
-			Include:    options.include,
-			Exclude:    options.exclude,
-			Remote:     options.remote,
-			RemoteName: options.remoteName,
-		},
-	)
-
-	if len(prunedBranches) > 0 {
-		for _, entries := range prunedBranches {
-			fmt.Printf("%s/%s deleted\n", entries[0], entries[1])
+	sweeperOptions := options.sweeper
+
+	if err := sweeperOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Find candidates first so they can be reviewed before anything is deleted
+	candidates, err := sweeper.Sweeper(sweeperOptions)
+
+	if err != nil {
+		log.Warn(err)
+	}
+
+	if deletable(candidates) > 0 && !sweeperOptions.DryRun && !options.yes {
+		if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+			log.Fatal("Refusing to delete branches without confirmation, stdin is not a terminal (use --yes to skip confirmation)")
+		}
+
+		if !confirm(os.Stdin, os.Stderr, candidates) {
+			log.Info("Aborted, no branches were deleted")
+			return
+		}
+	}
+
+	prunedBranches, err := sweeper.Prune(candidates, sweeperOptions)
+
+	if options.output != output.Table {
+		if err := output.Write(os.Stdout, options.output, prunedBranches); err != nil {
+			log.Error(err)
 		}
+	} else if len(prunedBranches) > 0 {
+		for _, report := range prunedBranches {
+			printReport(report)
+		}
+
+		printRemoteSkipped(prunedBranches)
 	} else {
 		log.Error("No branches found, nothing to delete")
 	}
@@ -34,3 +58,96 @@ func pruneBranches(options cmdOptions) {
 		log.Warn(err)
 	}
 }
+
+// printReport prints the outcome of a branch deletion in table mode
+func printReport(report sweeper.BranchReport) {
+	switch report.Action {
+	case sweeper.ActionSkipped:
+		if report.SkipReason == sweeper.SkipUnpushed {
+			fmt.Printf("%s/%s skipped: %d unpushed commits would be lost (use --force to delete it)\n", report.RepoName, report.BranchName(), report.UnpushedCommits)
+			return
+		}
+
+		fmt.Printf("%s/%s skipped: %s\n", report.RepoName, report.BranchName(), report.SkipReason)
+	case sweeper.ActionWouldDelete:
+		if !report.Branch.IsRemote() {
+			fmt.Printf("%s/%s would be deleted\n", report.RepoName, report.BranchName())
+		}
+
+		if report.Remote != "" {
+			fmt.Printf("%s/%s would be deleted on remote %s\n", report.RepoName, report.RemoteBranch.Short(), report.Remote)
+		}
+	default:
+		if report.DeletedLocal {
+			fmt.Printf("%s/%s deleted\n", report.RepoName, report.BranchName())
+		}
+
+		if report.DeletedRemote {
+			fmt.Printf("%s/%s deleted on remote %s\n", report.RepoName, report.RemoteBranch.Short(), report.Remote)
+		}
+	}
+}
+
+// printRemoteSkipped prints the branches whose remote branch is not deleted, e.g. because they have no upstream
+func printRemoteSkipped(reports []sweeper.BranchReport) {
+	header := false
+
+	for _, report := range reports {
+		if report.RemoteSkipReason == "" || report.Action == sweeper.ActionSkipped {
+			continue
+		}
+
+		if !header {
+			fmt.Println("\nNot deleted on a remote:")
+			header = true
+		}
+
+		fmt.Printf("%s/%s: %s\n", report.RepoName, report.BranchName(), report.RemoteSkipReason)
+	}
+}
+
+// confirm lists the candidates grouped by repository and asks the user to confirm their deletion
+func confirm(in io.Reader, out io.Writer, candidates []sweeper.BranchReport) bool {
+	repositories := 0
+	lastRepoPath := ""
+
+	for _, report := range candidates {
+		if report.Action == sweeper.ActionSkipped {
+			continue
+		}
+
+		if report.RepoPath != lastRepoPath {
+			fmt.Fprintf(out, "%s (%s)\n", report.RepoName, report.RepoPath)
+			lastRepoPath = report.RepoPath
+			repositories++
+		}
+
+		if report.Remote != "" && !report.Branch.IsRemote() {
+			fmt.Fprintf(out, "  %s (and %s/%s)\n", report.BranchName(), report.Remote, report.RemoteBranch.Short())
+		} else if report.RemoteSkipReason != "" {
+			fmt.Fprintf(out, "  %s (%s, local only)\n", report.BranchName(), report.RemoteSkipReason)
+		} else {
+			fmt.Fprintf(out, "  %s\n", report.BranchName())
+		}
+	}
+
+	fmt.Fprintf(out, "Delete %d branches in %d repositories? [y/N] ", deletable(candidates), repositories)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// deletable returns the number of candidates that are not skipped
+func deletable(candidates []sweeper.BranchReport) int {
+	count := 0
+
+	for _, report := range candidates {
+		if report.Action != sweeper.ActionSkipped {
+			count++
+		}
+	}
+
+	return count
+}
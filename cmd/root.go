@@ -3,8 +3,13 @@ package cmd
 import (
 	"os"
 
+	"github.com/byFrederick/branch-sweeper/cmd/config"
+	"github.com/byFrederick/branch-sweeper/cmd/history"
 	"github.com/byFrederick/branch-sweeper/cmd/list"
 	"github.com/byFrederick/branch-sweeper/cmd/prune"
+	"github.com/byFrederick/branch-sweeper/cmd/undo"
+	"github.com/byFrederick/branch-sweeper/pkg/output"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +19,10 @@ var rootCmd = &cobra.Command{
 	Use:     "branch-sweeper",
 	Short:   "Identify and remove stale Git branches across local repositories",
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("output")
+		return output.Validate(format)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -28,12 +37,57 @@ func Execute() {
 func init() {
 	rootCmd.AddCommand(list.Cmd)
 	rootCmd.AddCommand(prune.Cmd)
+	rootCmd.AddCommand(history.Cmd)
+	rootCmd.AddCommand(undo.Cmd)
+	rootCmd.AddCommand(config.Cmd)
 
-	rootCmd.PersistentFlags().StringP(
+	rootCmd.PersistentFlags().String(
+		"config",
+		"",
+		"Configuration file (default ~/.config/branch-sweeper/config.yaml), repositories may also contain a .branch-sweeper.yaml file",
+	)
+
+	rootCmd.PersistentFlags().StringArrayP(
 		"path",
 		"p",
-		".",
-		"Directory to scan for Git repos",
+		[]string{"."},
+		"Directory to scan for Git repos, can be repeated",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"repos-from",
+		"",
+		"Read the repositories from a file, or - for stdin, instead of scanning --path: a list of paths, a JSON array, a repo manifest or a .mrconfig",
+	)
+
+	rootCmd.PersistentFlags().Int(
+		"max-depth",
+		0,
+		"Maximum number of directories to descend below each path, 0 for no limit",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"follow-symlinks",
+		false,
+		"Follow symbolic links to directories while scanning, directories reached twice are scanned once",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"one-filesystem",
+		false,
+		"Don't scan directories on another filesystem than the path, e.g. network mounts",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"recurse-nested",
+		false,
+		"Keep scanning inside the repositories found for nested repositories, e.g. vendored checkouts",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"submodules",
+		false,
+		"Also sweep the submodules of the repositories found",
 	)
 
 	rootCmd.PersistentFlags().IntP(
@@ -43,31 +97,147 @@ func init() {
 		"Minimum days since last commit to mark a branch stale",
 	)
 
+	rootCmd.PersistentFlags().String(
+		"older-than",
+		"",
+		"Only sweep branches last updated before a duration ago (e.g. 36h, 30d, 6w, 3mo, 1y) or a date (e.g. 2025-01-01), replaces --days",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"newer-than",
+		"",
+		"Only sweep branches last updated after a duration ago or a date, without --days or --older-than every such branch is listed",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"date-source",
+		string(sweeper.DateSourceAuthor),
+		"Date defining when a branch was last updated: author, committer, reflog (last time the local branch moved) or newest-unique-commit",
+	)
+
 	rootCmd.PersistentFlags().BoolP(
 		"merged",
 		"m",
 		false,
-		"Include branches already merged into the base branch",
+		"Include branches already merged into a base branch",
 	)
 
-	rootCmd.PersistentFlags().StringP(
+	rootCmd.PersistentFlags().String(
+		"merge-detection",
+		"ancestry",
+		"How merged branches are detected: ancestry, patch-id (rebase merges), squash (squash merges) or any",
+	)
+
+	rootCmd.PersistentFlags().StringArrayP(
 		"base",
 		"b",
-		"main",
-		"Repository base branch",
+		[]string{"main"},
+		"Repository base branches or glob patterns, comma-separated or repeated (e.g. 'main,release/*'), or 'auto' to detect it per repository from the remote HEAD, init.defaultBranch or --base-fallback",
 	)
 
-	rootCmd.PersistentFlags().StringP(
+	rootCmd.PersistentFlags().Bool(
+		"merged-into-all",
+		false,
+		"Consider a branch merged only when it is merged into every base branch instead of any of them",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"base-fallback",
+		sweeper.DefaultBaseFallback,
+		"Base branches tried in order when --base is 'auto' and it can't be detected otherwise",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"remote-tracking",
+		false,
+		"Sweep the remote-tracking branches of --remote-name instead of local branches, prune deletes them on the remote",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"remote-name",
+		"origin",
+		"Name of Git remote",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"ssh-key",
+		"",
+		"Private key used to push to SSH remotes instead of the ssh-agent keys and ~/.ssh/config identities",
+	)
+
+	rootCmd.PersistentFlags().StringArrayP(
 		"include",
 		"i",
-		"",
-		"Glob pattern for branches to include (use braces for multiple patterns, e.g. '{feat*,fix*}')",
+		nil,
+		"Glob pattern for branches to include, repeat it or use braces for multiple patterns (e.g. '{feat*,fix*}')",
 	)
 
-	rootCmd.PersistentFlags().StringP(
+	rootCmd.PersistentFlags().StringArrayP(
 		"exclude",
 		"e",
-		"",
-		"Glob pattern for branches to exclude (use braces for multiple patterns, e.g. '{feat*,fix*}')",
+		nil,
+		"Glob pattern for branches to exclude, repeat it or use braces for multiple patterns (e.g. '{feat*,fix*}')",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"include-regex",
+		nil,
+		"Regular expression for branches to include, repeat it for multiple expressions",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"exclude-regex",
+		nil,
+		"Regular expression for branches to exclude, repeat it for multiple expressions",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"author",
+		nil,
+		"Only sweep branches whose commits author name or email matches the glob pattern (e.g. '*@example.com'), can be repeated",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"committer",
+		nil,
+		"Only sweep branches whose commits committer name or email matches the glob pattern, can be repeated",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"author-not",
+		nil,
+		"Don't sweep branches whose commits author name or email matches the glob pattern, can be repeated",
+	)
+
+	rootCmd.PersistentFlags().String(
+		"identity-scope",
+		string(sweeper.IdentityScopeTip),
+		"Commits matched by --author, --committer and --author-not: tip (latest commit) or unique (every commit not in the first base branch)",
+	)
+
+	rootCmd.PersistentFlags().StringArray(
+		"protected",
+		nil,
+		"Glob patterns of branches that are never deleted, comma-separated or repeated, in addition to the default ones (main, master, develop, production, release/*, hotfix/*)",
+	)
+
+	rootCmd.PersistentFlags().Bool(
+		"no-default-protected",
+		false,
+		"Don't protect the default branch patterns, only those of --protected",
+	)
+
+	rootCmd.PersistentFlags().IntP(
+		"jobs",
+		"j",
+		0,
+		"Number of repositories evaluated concurrently (default number of CPUs)",
+	)
+
+	rootCmd.PersistentFlags().StringP(
+		"output",
+		"o",
+		output.Table,
+		"Output format: table, json, ndjson, csv, yaml or template=<go template>",
 	)
 }
@@ -0,0 +1,51 @@
+package undo
+
+import (
+	"github.com/byFrederick/branch-sweeper/cmd/flags"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+type cmdOptions struct {
+	paths    []string
+	discover sweeper.DiscoverOptions
+	runID    string
+	output   string
+	sshKey   string
+}
+
+var Cmd = &cobra.Command{
+	Use:     "undo [run-id]",
+	Short:   "Restore branches deleted by a prune run (defaults to the most recent run)",
+	Example: "branch-sweeper undo 20250626T101500.123456Z-3f9a --path ~/",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		options := getOptions(cmd, args)
+		undoPrune(options)
+	},
+}
+
+func getOptions(cmd *cobra.Command, args []string) cmdOptions {
+	paths, discover, err := flags.Discovery(cmd)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output, _ := cmd.Flags().GetString("output")
+	sshKey, _ := cmd.Flags().GetString("ssh-key")
+
+	options := cmdOptions{
+		paths:    paths,
+		discover: discover,
+		output:   output,
+		sshKey:   sshKey,
+	}
+
+	if len(args) > 0 {
+		options.runID = args[0]
+	}
+
+	return options
+}
@@ -0,0 +1,46 @@
+package undo
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/byFrederick/branch-sweeper/pkg/output"
+	"github.com/byFrederick/branch-sweeper/pkg/prompt"
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/charmbracelet/log"
+)
+
+func undoPrune(options cmdOptions) {
+	auth := sweeper.AuthOptions{
+		SSHKeyFile: options.sshKey,
+		Passphrase: prompt.Passphrase,
+	}
+
+	restoredBranches, err := sweeper.Undo(options.paths, options.runID, auth, options.discover)
+
+	if options.output != output.Table {
+		if err := output.Write(os.Stdout, options.output, restoredBranches); err != nil {
+			log.Error(err)
+		}
+	} else if len(restoredBranches) > 0 {
+		for _, report := range restoredBranches {
+			if report.Action != sweeper.ActionRestored {
+				continue
+			}
+
+			if report.DeletedLocal {
+				fmt.Printf("%s/%s restored\n", report.RepoName, report.BranchName())
+			}
+
+			if report.DeletedRemote {
+				fmt.Printf("%s/%s restored on remote %s\n", report.RepoName, report.RemoteBranch.Short(), report.Remote)
+			}
+		}
+	} else {
+		log.Error("No branches found, nothing to restore")
+	}
+
+	if err != nil {
+		log.Warn(err)
+	}
+}
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// RepoFileName is the configuration file read from the root of every repository
+const RepoFileName = ".branch-sweeper.yaml"
+
+// Sources of the settings, besides the configuration files
+const (
+	SourceDefaults = "defaults"
+	SourceFlags    = "flags"
+)
+
+// Settings are the sweeper options that can be set in configuration files, unset settings are nil or empty
+type Settings struct {
+	Base         []string `json:"base,omitempty" yaml:"base,omitempty"`
+	Days         *int     `json:"days,omitempty" yaml:"days,omitempty"`
+	Include      []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	IncludeRegex []string `json:"include_regex,omitempty" yaml:"include_regex,omitempty"`
+	ExcludeRegex []string `json:"exclude_regex,omitempty" yaml:"exclude_regex,omitempty"`
+	Protected    []string `json:"protected,omitempty" yaml:"protected,omitempty"`
+	Remote       string   `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// Override holds the settings of the repositories whose path or name matches a glob pattern
+type Override struct {
+	// Match is matched against the repository path, ~ being the home directory, and against the repository name
+	// e.g. ~/work/** matches every repository under ~/work and legacy-* every repository named legacy-something
+	Match    string `yaml:"match"`
+	Settings `yaml:",inline"`
+}
+
+// File is the global configuration file, with default settings and per repository overrides
+type File struct {
+	Settings  `yaml:",inline"`
+	Overrides []Override `yaml:"overrides,omitempty"`
+}
+
+// Config combines the configuration files with the command line flags
+// Settings are resolved per repository, in increasing precedence: flag defaults, global file,
+// matching overrides in order, repository file and flags set on the command line
+type Config struct {
+	// Path is the global configuration file, empty if there is none
+	Path     string
+	File     File
+	Defaults Settings
+	Flags    Settings
+}
+
+// DefaultPath returns the path of the global configuration file, $XDG_CONFIG_HOME/branch-sweeper/config.yaml
+// which defaults to ~/.config/branch-sweeper/config.yaml
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "branch-sweeper", "config.yaml")
+}
+
+// New returns the configuration of the command, reading the global configuration file set by the config flag
+// A missing file is only an error when the flag is set
+func New(flags *pflag.FlagSet) (*Config, error) {
+	path, _ := flags.GetString("config")
+	explicit := path != ""
+
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	config := &Config{
+		Defaults: flagSettings(flags, false),
+		Flags:    flagSettings(flags, true),
+	}
+
+	file := File{}
+	err := readFile(path, &file)
+
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return config, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	config.Path = path
+	config.File = file
+
+	return config, nil
+}
+
+// Resolve returns the effective settings of the repository and the sources they were read from
+func (c *Config) Resolve(repoPath string) (Settings, []string, error) {
+	settings := c.Defaults
+	sources := []string{SourceDefaults}
+
+	if c.Path != "" {
+		settings = settings.Merge(c.File.Settings)
+		sources = append(sources, c.Path)
+	}
+
+	for _, override := range c.File.Overrides {
+		if override.matches(repoPath) {
+			settings = settings.Merge(override.Settings)
+			sources = append(sources, c.Path+" (match "+override.Match+")")
+		}
+	}
+
+	repoFile := filepath.Join(repoPath, RepoFileName)
+	repoSettings := Settings{}
+	err := readFile(repoFile, &repoSettings)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return Settings{}, nil, err
+	default:
+		if err := repoSettings.validate(); err != nil {
+			return Settings{}, nil, fmt.Errorf("invalid configuration file %s: %w", repoFile, err)
+		}
+
+		settings = settings.Merge(repoSettings)
+		sources = append(sources, repoFile)
+	}
+
+	if !c.Flags.empty() {
+		settings = settings.Merge(c.Flags)
+		sources = append(sources, SourceFlags)
+	}
+
+	return settings, sources, nil
+}
+
+// RepoOptions returns the sweeper options of a repository with its effective settings, see sweeper.SweeperOptions.RepoOptions
+func (c *Config) RepoOptions(repoPath string, options sweeper.SweeperOptions) (sweeper.SweeperOptions, error) {
+	settings, _, err := c.Resolve(repoPath)
+
+	if err != nil {
+		return options, err
+	}
+
+	return settings.Apply(options), nil
+}
+
+// Merge returns the settings overridden by the settings set in other
+func (s Settings) Merge(other Settings) Settings {
+	if other.Base != nil {
+		s.Base = other.Base
+	}
+
+	if other.Days != nil {
+		s.Days = other.Days
+	}
+
+	if other.Include != nil {
+		s.Include = other.Include
+	}
+
+	if other.Exclude != nil {
+		s.Exclude = other.Exclude
+	}
+
+	if other.IncludeRegex != nil {
+		s.IncludeRegex = other.IncludeRegex
+	}
+
+	if other.ExcludeRegex != nil {
+		s.ExcludeRegex = other.ExcludeRegex
+	}
+
+	if other.Protected != nil {
+		s.Protected = other.Protected
+	}
+
+	if other.Remote != "" {
+		s.Remote = other.Remote
+	}
+
+	return s
+}
+
+// Apply sets the sweeper options controlled by the settings
+func (s Settings) Apply(options sweeper.SweeperOptions) sweeper.SweeperOptions {
+	if s.Base != nil {
+		options.BaseBranches = s.Base
+	}
+
+	if s.Days != nil {
+		options.StaleDays = *s.Days
+	}
+
+	if s.Include != nil {
+		options.Include = s.Include
+	}
+
+	if s.Exclude != nil {
+		options.Exclude = s.Exclude
+	}
+
+	if s.IncludeRegex != nil {
+		options.IncludeRegex = s.IncludeRegex
+	}
+
+	if s.ExcludeRegex != nil {
+		options.ExcludeRegex = s.ExcludeRegex
+	}
+
+	if s.Protected != nil {
+		options.Protected = s.Protected
+	}
+
+	if s.Remote != "" {
+		options.RemoteName = s.Remote
+	}
+
+	return options
+}
+
+// empty reports whether no setting is set
+func (s Settings) empty() bool {
+	return s.Base == nil && s.Days == nil && s.Include == nil && s.Exclude == nil && s.IncludeRegex == nil && s.ExcludeRegex == nil &&
+		s.Protected == nil && s.Remote == ""
+}
+
+// validate checks the settings values and patterns
+func (s Settings) validate() error {
+	if s.Days != nil && *s.Days < 0 {
+		return fmt.Errorf("days can't be negative")
+	}
+
+	patterns := slices.Concat(s.Include, s.Exclude, s.Base, s.Protected)
+
+	for _, pattern := range patterns {
+		if _, err := sweeper.CompileGlob(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range slices.Concat(s.IncludeRegex, s.ExcludeRegex) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the settings and overrides of the file
+func (f File) validate() error {
+	if err := f.Settings.validate(); err != nil {
+		return err
+	}
+
+	for _, override := range f.Overrides {
+		if override.Match == "" {
+			return fmt.Errorf("override without match pattern")
+		}
+
+		if _, err := sweeper.CompileGlob(expandHome(override.Match), '/'); err != nil {
+			return fmt.Errorf("invalid override match %q: %w", override.Match, err)
+		}
+
+		if err := override.Settings.validate(); err != nil {
+			return fmt.Errorf("override %q: %w", override.Match, err)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the override applies to the repository
+func (o Override) matches(repoPath string) bool {
+	g, err := sweeper.CompileGlob(expandHome(o.Match), '/')
+
+	if err != nil {
+		return false
+	}
+
+	if absPath, err := filepath.Abs(repoPath); err == nil {
+		repoPath = absPath
+	}
+
+	return g.Match(filepath.ToSlash(repoPath)) || g.Match(filepath.Base(repoPath))
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(pattern string) string {
+	rest, ok := strings.CutPrefix(pattern, "~/")
+
+	if !ok {
+		return pattern
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return pattern
+	}
+
+	return filepath.ToSlash(filepath.Join(home, rest))
+}
+
+// readFile decodes a YAML configuration file, rejecting unknown settings
+func readFile(path string, value any) error {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(value); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// flagSettings returns the settings set by the command flags, only those set on the command line if changedOnly is true
+func flagSettings(flags *pflag.FlagSet, changedOnly bool) Settings {
+	settings := Settings{}
+	set := func(name string) bool {
+		return flags.Lookup(name) != nil && (!changedOnly || flags.Changed(name))
+	}
+
+	if set("base") {
+		base, _ := flags.GetStringArray("base")
+		settings.Base = sweeper.SplitPatterns(base)
+	}
+
+	if set("days") {
+		days, _ := flags.GetInt("days")
+		settings.Days = &days
+	}
+
+	if set("include") {
+		settings.Include, _ = flags.GetStringArray("include")
+	}
+
+	if set("exclude") {
+		settings.Exclude, _ = flags.GetStringArray("exclude")
+	}
+
+	if set("include-regex") {
+		settings.IncludeRegex, _ = flags.GetStringArray("include-regex")
+	}
+
+	if set("exclude-regex") {
+		settings.ExcludeRegex, _ = flags.GetStringArray("exclude-regex")
+	}
+
+	if set("protected") {
+		protected, _ := flags.GetStringArray("protected")
+		settings.Protected = sweeper.SplitPatterns(protected)
+	}
+
+	if set("remote-name") {
+		settings.Remote, _ = flags.GetString("remote-name")
+	}
+
+	return settings
+}
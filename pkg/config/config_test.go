@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/spf13/pflag"
+)
+
+func testFlags(t *testing.T, configPath string, args ...string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("config", configPath, "")
+	flags.StringArray("base", []string{"main"}, "")
+	flags.Int("days", 30, "")
+	flags.StringArray("include", nil, "")
+	flags.StringArray("exclude", nil, "")
+	flags.StringArray("protected", nil, "")
+	flags.String("remote-name", "origin", "")
+
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Error parsing flags: %v", err)
+	}
+
+	return flags
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	legacy := filepath.Join(dir, "legacy-app")
+	other := filepath.Join(dir, "other")
+
+	for _, path := range []string{legacy, other} {
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatalf("Error creating %s: %v", path, err)
+		}
+	}
+
+	writeTestFile(t, configPath, `
+days: 60
+exclude: ["wip/*"]
+protected: [develop]
+overrides:
+  - match: "legacy-*"
+    base: [master]
+    days: 120
+`)
+	writeTestFile(t, filepath.Join(legacy, RepoFileName), "remote: upstream\n")
+
+	cfg, err := New(testFlags(t, configPath, "--include", "feat*"))
+
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	settings, sources, err := cfg.Resolve(legacy)
+
+	if err != nil {
+		t.Fatalf("Resolve returned error: %v", err)
+	}
+
+	if !slices.Equal(settings.Base, []string{"master"}) || *settings.Days != 120 || settings.Remote != "upstream" {
+		t.Errorf("Expected override and repository settings, got %+v", settings)
+	}
+
+	if !slices.Equal(settings.Exclude, []string{"wip/*"}) || !slices.Equal(settings.Include, []string{"feat*"}) || !slices.Equal(settings.Protected, []string{"develop"}) {
+		t.Errorf("Expected global and flag settings, got %+v", settings)
+	}
+
+	if len(sources) != 5 || sources[0] != SourceDefaults || sources[len(sources)-1] != SourceFlags {
+		t.Errorf("Unexpected sources %v", sources)
+	}
+
+	options, err := cfg.RepoOptions(other, sweeper.SweeperOptions{StaleDays: 30, BaseBranches: []string{"main"}})
+
+	if err != nil {
+		t.Fatalf("RepoOptions returned error: %v", err)
+	}
+
+	if options.StaleDays != 60 || !slices.Equal(options.BaseBranches, []string{"main"}) || options.RemoteName != "origin" {
+		t.Errorf("Expected global settings without override, got %+v", options)
+	}
+}
+
+func TestFlagsTakePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, configPath, "days: 60\n")
+	writeTestFile(t, filepath.Join(dir, RepoFileName), "days: 90\n")
+
+	cfg, err := New(testFlags(t, configPath, "--days", "10", "--base", "{main,develop},release/*", "--protected", "wip/{x,y}"))
+
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	settings, _, err := cfg.Resolve(dir)
+
+	if err != nil || *settings.Days != 10 {
+		t.Errorf("Expected days flag to take precedence: %v", err)
+	}
+
+	if !slices.Equal(settings.Base, []string{"{main,develop}", "release/*"}) || !slices.Equal(settings.Protected, []string{"wip/{x,y}"}) {
+		t.Errorf("Expected patterns split outside brace groups, got %q and %q", settings.Base, settings.Protected)
+	}
+}
+
+func TestNewWithInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := New(testFlags(t, filepath.Join(dir, "missing.yaml"))); err == nil {
+		t.Errorf("Expected error with missing explicit configuration file")
+	}
+
+	for name, content := range map[string]string{
+		"unknown.yaml":  "stale: 30\n",
+		"negative.yaml": "days: -1\n",
+		"pattern.yaml":  "overrides:\n  - match: \"[\"\n",
+		"regex.yaml":    "include_regex: [\"(\"]\n",
+	} {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, content)
+
+		if _, err := New(testFlags(t, path)); err == nil {
+			t.Errorf("Expected error with configuration file %s", name)
+		}
+	}
+}
+
+func TestNewWithoutDefaultFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	cfg, err := New(testFlags(t, ""))
+
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	settings, sources, err := cfg.Resolve(t.TempDir())
+
+	if err != nil || *settings.Days != 30 || len(sources) != 1 {
+		t.Errorf("Expected flag defaults only, got %+v %v %v", settings, sources, err)
+	}
+}
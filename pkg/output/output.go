@@ -0,0 +1,264 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported output formats
+const (
+	Table  = "table"
+	JSON   = "json"
+	NDJSON = "ndjson"
+	CSV    = "csv"
+	YAML   = "yaml"
+	// TemplatePrefix is followed by a Go template executed for every record, e.g. template={{.Branch}}
+	TemplatePrefix = "template="
+)
+
+// Record is the machine-readable representation of a sweeper.BranchReport
+// Field names are part of the tool's output contract and must remain stable
+type Record struct {
+	Repository       string    `json:"repository" yaml:"repository"`
+	RepositoryName   string    `json:"repository_name" yaml:"repository_name"`
+	GitDir           string    `json:"git_dir" yaml:"git_dir"`
+	Branch           string    `json:"branch" yaml:"branch"`
+	Hash             string    `json:"hash" yaml:"hash"`
+	LastCommitDate   time.Time `json:"last_commit_date" yaml:"last_commit_date"`
+	DateSource       string    `json:"date_source" yaml:"date_source"`
+	AgeDays          int       `json:"age_days" yaml:"age_days"`
+	Author           string    `json:"author" yaml:"author"`
+	AuthorEmail      string    `json:"author_email" yaml:"author_email"`
+	Committer        string    `json:"committer" yaml:"committer"`
+	CommitterEmail   string    `json:"committer_email" yaml:"committer_email"`
+	BaseBranch       string    `json:"base_branch" yaml:"base_branch"`
+	Merged           bool      `json:"merged" yaml:"merged"`
+	MergedBy         string    `json:"merged_by" yaml:"merged_by"`
+	MergedInto       []string  `json:"merged_into" yaml:"merged_into"`
+	Reasons          []string  `json:"reasons" yaml:"reasons"`
+	Action           string    `json:"action" yaml:"action"`
+	SkipReason       string    `json:"skip_reason" yaml:"skip_reason"`
+	UnpushedCommits  int       `json:"unpushed_commits" yaml:"unpushed_commits"`
+	DeletedLocal     bool      `json:"deleted_local" yaml:"deleted_local"`
+	DeletedRemote    bool      `json:"deleted_remote" yaml:"deleted_remote"`
+	Remote           string    `json:"remote" yaml:"remote"`
+	RemoteBranch     string    `json:"remote_branch" yaml:"remote_branch"`
+	RemoteSkipReason string    `json:"remote_skip_reason" yaml:"remote_skip_reason"`
+	RunID            string    `json:"run_id" yaml:"run_id"`
+	BackupRef        string    `json:"backup_ref" yaml:"backup_ref"`
+	Error            string    `json:"error" yaml:"error"`
+}
+
+var csvHeader = []string{
+	"repository",
+	"repository_name",
+	"git_dir",
+	"branch",
+	"hash",
+	"last_commit_date",
+	"date_source",
+	"age_days",
+	"author",
+	"author_email",
+	"committer",
+	"committer_email",
+	"base_branch",
+	"merged",
+	"merged_by",
+	"merged_into",
+	"reasons",
+	"action",
+	"skip_reason",
+	"unpushed_commits",
+	"deleted_local",
+	"deleted_remote",
+	"remote",
+	"remote_branch",
+	"remote_skip_reason",
+	"run_id",
+	"backup_ref",
+	"error",
+}
+
+// Validate checks that format is a supported output format
+func Validate(format string) error {
+	switch format {
+	case Table, JSON, NDJSON, CSV, YAML:
+		return nil
+	}
+
+	if tmpl, ok := strings.CutPrefix(format, TemplatePrefix); ok {
+		if _, err := template.New("output").Parse(tmpl); err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported output format %q (supported: table, json, ndjson, csv, yaml, template=<go template>)", format)
+}
+
+// NewRecord converts a branch report into its machine-readable representation
+func NewRecord(report sweeper.BranchReport) Record {
+	record := Record{
+		Repository:       report.RepoPath,
+		RepositoryName:   report.RepoName,
+		GitDir:           report.GitDir,
+		Branch:           report.BranchName(),
+		Hash:             report.Hash.String(),
+		LastCommitDate:   report.LastCommit,
+		DateSource:       string(report.DateSource),
+		AgeDays:          int(report.Age.Hours() / 24),
+		Author:           report.Author.Name,
+		AuthorEmail:      report.Author.Email,
+		Committer:        report.Committer.Name,
+		CommitterEmail:   report.Committer.Email,
+		BaseBranch:       report.BaseBranch,
+		Merged:           report.Merged,
+		MergedBy:         string(report.MergedBy),
+		MergedInto:       report.MergedInto,
+		Reasons:          report.Reasons,
+		Action:           string(report.Action),
+		SkipReason:       report.SkipReason,
+		UnpushedCommits:  report.UnpushedCommits,
+		DeletedLocal:     report.DeletedLocal,
+		DeletedRemote:    report.DeletedRemote,
+		Remote:           report.Remote,
+		RemoteBranch:     report.RemoteBranch.Short(),
+		RemoteSkipReason: report.RemoteSkipReason,
+		RunID:            report.RunID,
+		BackupRef:        report.BackupRef.String(),
+	}
+
+	if record.MergedInto == nil {
+		record.MergedInto = []string{}
+	}
+
+	if record.Reasons == nil {
+		record.Reasons = []string{}
+	}
+
+	if report.Err != nil {
+		record.Error = report.Err.Error()
+	}
+
+	return record
+}
+
+// Write encodes the reports to w using the given machine-readable format
+// The table format is rendered by each command and is not handled here
+func Write(w io.Writer, format string, reports []sweeper.BranchReport) error {
+	records := make([]Record, 0, len(reports))
+
+	for _, report := range reports {
+		records = append(records, NewRecord(report))
+	}
+
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case NDJSON:
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CSV:
+		return writeCSV(w, records)
+	case YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	if tmpl, ok := strings.CutPrefix(format, TemplatePrefix); ok {
+		return writeTemplate(w, tmpl, records)
+	}
+
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+// writeCSV writes one row per record preceded by a header row
+func writeCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		row := []string{
+			record.Repository,
+			record.RepositoryName,
+			record.GitDir,
+			record.Branch,
+			record.Hash,
+			record.LastCommitDate.Format(time.RFC3339),
+			record.DateSource,
+			strconv.Itoa(record.AgeDays),
+			record.Author,
+			record.AuthorEmail,
+			record.Committer,
+			record.CommitterEmail,
+			record.BaseBranch,
+			strconv.FormatBool(record.Merged),
+			record.MergedBy,
+			strings.Join(record.MergedInto, ";"),
+			strings.Join(record.Reasons, ";"),
+			record.Action,
+			record.SkipReason,
+			strconv.Itoa(record.UnpushedCommits),
+			strconv.FormatBool(record.DeletedLocal),
+			strconv.FormatBool(record.DeletedRemote),
+			record.Remote,
+			record.RemoteBranch,
+			record.RemoteSkipReason,
+			record.RunID,
+			record.BackupRef,
+			record.Error,
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeTemplate executes the Go template once per record, each followed by a new line
+func writeTemplate(w io.Writer, tmpl string, records []Record) error {
+	t, err := template.New("output").Parse(tmpl)
+
+	if err != nil {
+		return fmt.Errorf("invalid output template: %w", err)
+	}
+
+	for _, record := range records {
+		if err := t.Execute(w, record); err != nil {
+			return fmt.Errorf("failed to execute output template: %w", err)
+		}
+
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
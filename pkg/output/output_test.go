@@ -0,0 +1,180 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byFrederick/branch-sweeper/pkg/sweeper"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/yaml.v3"
+)
+
+func testReports() []sweeper.BranchReport {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	return []sweeper.BranchReport{
+		{
+			RepoPath:   "/repos/app",
+			RepoName:   "app",
+			Branch:     plumbing.NewBranchReferenceName("feature/login"),
+			Hash:       plumbing.NewHash("0123456789abcdef0123456789abcdef01234567"),
+			Author:     object.Signature{Name: "Jane", Email: "jane@test.com", When: date},
+			Committer:  object.Signature{Name: "Jane", Email: "jane@test.com", When: date},
+			LastCommit: date,
+			DateSource: sweeper.DateSourceCommitter,
+			Age:        45 * 24 * time.Hour,
+			Merged:     true,
+			MergedBy:   sweeper.MergeDetectionSquash,
+			MergedInto: []string{"main", "release/1.0"},
+			BaseBranch: "main",
+			Reasons:    []string{sweeper.ReasonStale, sweeper.ReasonMerged},
+			Action:     sweeper.ActionFailed,
+			Err:        errors.New("app failed to delete branch"),
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, format := range []string{Table, JSON, NDJSON, CSV, YAML, "template={{.Branch}}"} {
+		if err := Validate(format); err != nil {
+			t.Errorf("Validate(%q) returned error: %v", format, err)
+		}
+	}
+
+	for _, format := range []string{"xml", "template={{.Branch"} {
+		if err := Validate(format); err == nil {
+			t.Errorf("Expected Validate(%q) to return an error", format)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, JSON, testReports()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	var records []map[string]any
+
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+
+	expected := map[string]any{
+		"repository":  "/repos/app",
+		"branch":      "feature/login",
+		"author":      "Jane",
+		"merged":      true,
+		"action":      "failed",
+		"age_days":    float64(45),
+		"date_source": "committer",
+		"error":       "app failed to delete branch",
+	}
+
+	for key, value := range expected {
+		if records[0][key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, records[0][key])
+		}
+	}
+}
+
+func TestWriteJSONWithoutReports(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, JSON, nil); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("Expected empty JSON array, got %q", buf.String())
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	reports := append(testReports(), testReports()...)
+
+	if err := Write(&buf, NDJSON, reports); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	for _, line := range lines {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Errorf("Invalid JSON line %q: %v", line, err)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, CSV, testReports()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+
+	if err != nil {
+		t.Fatalf("Invalid CSV output: %v", err)
+	}
+
+	if len(rows) != 2 || len(rows[1]) != len(csvHeader) {
+		t.Fatalf("Expected header and 1 row with %d columns", len(csvHeader))
+	}
+
+	branch, reasons := slices.Index(rows[0], "branch"), slices.Index(rows[0], "reasons")
+	mergedInto := slices.Index(rows[0], "merged_into")
+
+	if rows[1][branch] != "feature/login" || rows[1][reasons] != "stale;merged" || rows[1][mergedInto] != "main;release/1.0" {
+		t.Errorf("Unexpected CSV row: %v", rows[1])
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, YAML, testReports()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	var records []Record
+
+	if err := yaml.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("Invalid YAML output: %v", err)
+	}
+
+	if len(records) != 1 || records[0].Branch != "feature/login" {
+		t.Errorf("Unexpected YAML records: %v", records)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Write(&buf, "template={{.RepositoryName}}:{{.Branch}}", testReports()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	if buf.String() != "app:feature/login\n" {
+		t.Errorf("Unexpected template output %q", buf.String())
+	}
+}
@@ -0,0 +1,43 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	passphrases = map[string][]byte{}
+	mu          sync.Mutex
+)
+
+// Passphrase asks for the passphrase of an encrypted SSH key on the terminal without echoing it
+// Passphrases are remembered per key file so every repository doesn't ask again
+func Passphrase(keyFile string) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if passphrase, ok := passphrases[keyFile]; ok {
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("stdin is not a terminal, load the key in ssh-agent instead")
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", keyFile)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	passphrases[keyFile] = passphrase
+
+	return passphrase, nil
+}
@@ -0,0 +1,112 @@
+package sweeper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ageDuration matches the relative age expressions, a number followed by a unit
+var ageDuration = regexp.MustCompile(`^(\d+)(h|d|w|mo|y)$`)
+
+// ParseAge parses an age expression into the time it designates
+// It is either a duration before now, in hours (h), days (d), weeks (w), months (mo) or years (y), e.g. 36h, 30d or 6w,
+// a date, e.g. 2025-01-01, or a date and time in RFC 3339 format, e.g. 2025-01-01T12:00:00Z
+func ParseAge(value string, now time.Time) (time.Time, error) {
+	if match := ageDuration.FindStringSubmatch(value); match != nil {
+		n, err := strconv.Atoi(match[1])
+
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid age %q: %w", value, err)
+		}
+
+		switch match[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "mo":
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return date, nil
+	}
+
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid age %q (use a duration like 30d, 6w, 3mo or 1y, or a date like 2025-01-01)", value)
+}
+
+// ParseAgeWindow parses the older than and newer than age expressions of the command line, see ParseAge
+// It returns the OlderThan, NewerThan and StaleDays options, days is the stale days and daysChanged whether they were given
+// With only newer than, branches of any age are included instead of those older than the default stale days, StaleDays is 0
+func ParseAgeWindow(olderThan string, newerThan string, days int, daysChanged bool, now time.Time) (time.Time, time.Time, int, error) {
+	if olderThan != "" && daysChanged {
+		return time.Time{}, time.Time{}, 0, fmt.Errorf("--days and --older-than can't be combined, --older-than replaces --days")
+	}
+
+	older, newer := time.Time{}, time.Time{}
+
+	for _, flag := range []struct {
+		name  string
+		value string
+		time  *time.Time
+	}{{"older-than", olderThan, &older}, {"newer-than", newerThan, &newer}} {
+		if flag.value == "" {
+			continue
+		}
+
+		date, err := ParseAge(flag.value, now)
+
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("invalid --%s: %w", flag.name, err)
+		}
+
+		*flag.time = date
+	}
+
+	if !newer.IsZero() && older.IsZero() && !daysChanged {
+		days = 0
+	}
+
+	return older, newer, days, nil
+}
+
+// inAgeWindow checks whether the branch last update is within the options age window
+// It must be older than OlderThan, or StaleDays when OlderThan is not set, and newer than NewerThan if set
+func inAgeWindow(date time.Time, options SweeperOptions) bool {
+	if options.OlderThan.IsZero() && !isStale(date, options.StaleDays) {
+		return false
+	}
+
+	if !options.OlderThan.IsZero() && date.After(options.OlderThan) {
+		return false
+	}
+
+	return options.NewerThan.IsZero() || date.After(options.NewerThan)
+}
+
+// ageReasons returns the reasons a branch within the options age window matched
+// A branch is stale unless the window only has a newer bound, NewerThan without OlderThan nor StaleDays
+func ageReasons(options SweeperOptions) []string {
+	reasons := []string{}
+
+	if options.NewerThan.IsZero() || !options.OlderThan.IsZero() || options.StaleDays > 0 {
+		reasons = append(reasons, ReasonStale)
+	}
+
+	if !options.NewerThan.IsZero() {
+		reasons = append(reasons, ReasonNewerThan)
+	}
+
+	return reasons
+}
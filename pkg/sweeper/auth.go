@@ -0,0 +1,394 @@
+package sweeper
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	sshagent "github.com/xanzy/ssh-agent"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthOptions configures how remote repositories are authenticated when pushing
+type AuthOptions struct {
+	// SSHKeyFile is a private key used instead of the ssh-agent keys and the ~/.ssh/config identities
+	SSHKeyFile string
+	// Passphrase returns the passphrase of an encrypted SSH key, encrypted keys are skipped when nil
+	Passphrase func(keyFile string) ([]byte, error)
+}
+
+// tokenUsername is the username sent along with a token, GitHub requires it while other hosts ignore it
+const tokenUsername = "x-access-token"
+
+// defaultIdentityFiles lists the SSH keys tried after the ~/.ssh/config identities, like ssh does
+var defaultIdentityFiles = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// remoteEndpoint returns the endpoint of the first URL of the remote
+// Relative local paths, e.g. ../remote.git, are resolved from the repository working tree like git does,
+// or from the git directory of bare repositories, instead of the current working directory
+func remoteEndpoint(repoName string, repo *git.Repository, remote *git.Remote) (*transport.Endpoint, error) {
+	urls := remote.Config().URLs
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("%s remote %s has no URL", repoName, remote.Config().Name)
+	}
+
+	endpoint, err := transport.NewEndpoint(urls[0])
+
+	if err != nil {
+		return nil, fmt.Errorf("%s invalid URL of remote %s: %w", repoName, remote.Config().Name, err)
+	}
+
+	// NewEndpoint makes local paths absolute from the current working directory, file:// URLs are always absolute
+	if endpoint.Protocol != "file" || strings.HasPrefix(urls[0], "file://") || filepath.IsAbs(urls[0]) {
+		return endpoint, nil
+	}
+
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get git directory: %w", repoName, err)
+	}
+
+	if worktree, err := repo.Worktree(); err == nil {
+		dir = worktree.Filesystem.Root()
+	}
+
+	if endpoint, err = transport.NewEndpoint(filepath.Join(dir, urls[0])); err != nil {
+		return nil, fmt.Errorf("%s invalid URL of remote %s: %w", repoName, remote.Config().Name, err)
+	}
+
+	return endpoint, nil
+}
+
+// remoteAuth returns the authentication method of the remote endpoint, chosen by the scheme of its URL
+// HTTPS remotes use the URL credentials, a token from the environment, the git credential helpers or ~/.netrc
+// SSH remotes use the key file of the options, or the ssh-agent keys and the ~/.ssh/config identities
+// Other remotes, e.g. local paths, need no authentication
+func remoteAuth(repoName string, endpoint *transport.Endpoint, options AuthOptions) (transport.AuthMethod, error) {
+	switch endpoint.Protocol {
+	case "http", "https":
+		return httpAuth(endpoint), nil
+	case "ssh":
+		auth, err := sshAuth(endpoint, options)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to set up SSH authentication: %w", repoName, err)
+		}
+
+		return auth, nil
+	default:
+		return nil, nil
+	}
+}
+
+// httpAuth returns the basic auth credentials of an HTTP(S) endpoint, or nil to push anonymously
+// $GITHUB_TOKEN is only sent to GitHub hosts, $GIT_TOKEN is sent to any host once the other sources are exhausted
+func httpAuth(endpoint *transport.Endpoint) transport.AuthMethod {
+	if endpoint.User != "" && endpoint.Password != "" {
+		return &http.BasicAuth{Username: endpoint.User, Password: endpoint.Password}
+	}
+
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && slices.Contains(githubHosts(), strings.ToLower(endpoint.Host)) {
+		return tokenAuth(endpoint, token)
+	}
+
+	if username, password, ok := credentialFill(endpoint); ok {
+		return &http.BasicAuth{Username: username, Password: password}
+	}
+
+	if username, password, ok := netrcCredentials(netrcPath(), endpoint.Host); ok {
+		return &http.BasicAuth{Username: username, Password: password}
+	}
+
+	if token := os.Getenv("GIT_TOKEN"); token != "" {
+		return tokenAuth(endpoint, token)
+	}
+
+	return nil
+}
+
+// tokenAuth returns the basic auth credentials of a token, with the URL username if any
+func tokenAuth(endpoint *transport.Endpoint, token string) transport.AuthMethod {
+	username := endpoint.User
+
+	if username == "" {
+		username = tokenUsername
+	}
+
+	return &http.BasicAuth{Username: username, Password: token}
+}
+
+// githubHosts returns the hosts $GITHUB_TOKEN is sent to, github.com and the host of $GITHUB_SERVER_URL,
+// set by GitHub Actions, e.g. a GitHub Enterprise server
+func githubHosts() []string {
+	hosts := []string{"github.com"}
+
+	if server, err := url.Parse(os.Getenv("GITHUB_SERVER_URL")); err == nil && server.Hostname() != "" {
+		hosts = append(hosts, strings.ToLower(server.Hostname()))
+	}
+
+	return hosts
+}
+
+// credentialFill asks the git credential helpers for the credentials of the endpoint
+// Terminal prompts are disabled so it never blocks, credentials are only returned if a helper knows them
+func credentialFill(endpoint *transport.Endpoint) (string, string, bool) {
+	host := endpoint.Host
+
+	if endpoint.Port != 0 {
+		host += ":" + strconv.Itoa(endpoint.Port)
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n", endpoint.Protocol, host, strings.TrimPrefix(endpoint.Path, "/"))
+
+	if endpoint.User != "" {
+		input += "username=" + endpoint.User + "\n"
+	}
+
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input + "\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		return "", "", false
+	}
+
+	return parseCredential(out)
+}
+
+// parseCredential returns the username and password of a git credential helper response
+func parseCredential(out []byte) (string, string, bool) {
+	username, password := "", ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+
+	return username, password, password != ""
+}
+
+// netrcPath returns the path of the netrc file, $NETRC or ~/.netrc
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcCredentials returns the login and password of the host from a netrc file
+// The first machine entry matching the host wins, the default entry is used otherwise
+func netrcCredentials(path string, host string) (string, string, bool) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", "", false
+	}
+
+	type entry struct {
+		login, password string
+	}
+
+	var matched, fallback, current *entry
+
+	fields := strings.Fields(string(content))
+
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			current = nil
+
+			if i+1 < len(fields) && fields[i+1] == host && matched == nil {
+				matched = &entry{}
+				current = matched
+			}
+
+			i++
+		case "default":
+			current = nil
+
+			if fallback == nil {
+				fallback = &entry{}
+				current = fallback
+			}
+		case "login":
+			if i+1 < len(fields) && current != nil {
+				current.login = fields[i+1]
+			}
+
+			i++
+		case "password":
+			if i+1 < len(fields) && current != nil {
+				current.password = fields[i+1]
+			}
+
+			i++
+		case "account":
+			i++
+		}
+	}
+
+	if matched == nil {
+		matched = fallback
+	}
+
+	if matched == nil || matched.password == "" {
+		return "", "", false
+	}
+
+	return matched.login, matched.password, true
+}
+
+// sshAuth returns the public keys authentication of an SSH endpoint
+// The user comes from the URL, then from ~/.ssh/config, and defaults to git
+func sshAuth(endpoint *transport.Endpoint, options AuthOptions) (transport.AuthMethod, error) {
+	user := endpoint.User
+
+	if user == "" {
+		user = ssh_config.Get(endpoint.Host, "User")
+	}
+
+	if user == "" {
+		user = "git"
+	}
+
+	if options.SSHKeyFile != "" {
+		signer, err := loadSigner(options.SSHKeyFile, options.Passphrase)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &gitssh.PublicKeys{User: user, Signer: signer}, nil
+	}
+
+	return &gitssh.PublicKeysCallback{
+		User: user,
+		Callback: func() ([]ssh.Signer, error) {
+			return sshSigners(endpoint.Host, options)
+		},
+	}, nil
+}
+
+// sshSigners returns the ssh-agent keys followed by the ~/.ssh/config identities of the host
+// Encrypted identities are only decrypted when ssh-agent has no keys, to avoid needless passphrase prompts
+func sshSigners(host string, options AuthOptions) ([]ssh.Signer, error) {
+	signers := []ssh.Signer{}
+
+	// The agent connection must stay open while the signers are used, like go-git does
+	if agent, _, err := sshagent.New(); err == nil {
+		if agentSigners, err := agent.Signers(); err == nil {
+			signers = append(signers, agentSigners...)
+		}
+	}
+
+	passphrase := options.Passphrase
+
+	if len(signers) > 0 {
+		passphrase = nil
+	}
+
+	for _, keyFile := range identityFiles(host) {
+		signer, err := loadSigner(keyFile, passphrase)
+
+		if err == nil {
+			signers = append(signers, signer)
+			continue
+		}
+
+		var missing *ssh.PassphraseMissingError
+
+		if !errors.Is(err, os.ErrNotExist) && !errors.As(err, &missing) {
+			return nil, err
+		}
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no SSH keys found in ssh-agent or ~/.ssh, use an SSH key file")
+	}
+
+	return signers, nil
+}
+
+// identityFiles returns the ~/.ssh/config identity files of the host followed by the default ones, with ~ expanded
+func identityFiles(host string) []string {
+	files := []string{}
+	home, _ := os.UserHomeDir()
+
+	for _, file := range append(ssh_config.GetAll(host, "IdentityFile"), defaultIdentityFiles...) {
+		if rest, ok := strings.CutPrefix(file, "~/"); ok {
+			file = filepath.Join(home, rest)
+		}
+
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// loadSigner reads a private key file, asking for its passphrase when it is encrypted
+func loadSigner(keyFile string, passphrase func(keyFile string) ([]byte, error)) (ssh.Signer, error) {
+	pem, err := os.ReadFile(keyFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", keyFile, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+
+	var missing *ssh.PassphraseMissingError
+
+	if !errors.As(err, &missing) || passphrase == nil {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key %s: %w", keyFile, err)
+		}
+
+		return signer, nil
+	}
+
+	secret, err := passphrase(keyFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passphrase of SSH key %s: %w", keyFile, err)
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, secret)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH key %s: %w", keyFile, err)
+	}
+
+	return signer, nil
+}
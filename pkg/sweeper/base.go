@@ -0,0 +1,146 @@
+package sweeper
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gobwas/glob"
+)
+
+// BaseBranchAuto resolves the base branch of every repository, see detectBaseBranch
+const BaseBranchAuto = "auto"
+
+// DefaultBaseFallback lists the base branches tried, in order, when the base branch can't be detected otherwise
+var DefaultBaseFallback = []string{"main", "master", "develop"}
+
+// detectBaseBranch resolves the base branch of a repository from, in order,
+// the remote HEAD (refs/remotes/<remote>/HEAD), init.defaultBranch and the fallback list
+// Only candidates with an existing local branch, or remote-tracking branch if remoteTracking is set, are considered
+func detectBaseBranch(repoName string, repo *git.Repository, remoteName string, fallback []string, remoteTracking bool) (string, error) {
+	candidates := []string{}
+
+	remoteHead, err := repo.Reference(plumbing.NewRemoteHEADReferenceName(remoteName), false)
+
+	if err == nil && remoteHead.Type() == plumbing.SymbolicReference {
+		candidates = append(candidates, strings.TrimPrefix(remoteHead.Target().String(), "refs/remotes/"+remoteName+"/"))
+	}
+
+	if cfg, err := repo.ConfigScoped(config.GlobalScope); err == nil && cfg.Init.DefaultBranch != "" {
+		candidates = append(candidates, cfg.Init.DefaultBranch)
+	}
+
+	if len(fallback) == 0 {
+		fallback = DefaultBaseFallback
+	}
+
+	candidates = append(candidates, fallback...)
+
+	for _, candidate := range candidates {
+		name := plumbing.NewBranchReferenceName(candidate)
+
+		if remoteTracking {
+			name = plumbing.NewRemoteReferenceName(remoteName, candidate)
+		}
+
+		_, err := repo.Reference(name, false)
+
+		if err == nil {
+			return candidate, nil
+		}
+
+		if err != plumbing.ErrReferenceNotFound {
+			return "", fmt.Errorf("%s branch lookup failed: %w", repoName, err)
+		}
+	}
+
+	return "", fmt.Errorf("%s base branch could not be detected (tried %s)", repoName, strings.Join(candidates, ", "))
+}
+
+// resolveBaseBranches returns the branches matching the base branch patterns of the options
+// BaseBranchAuto patterns are replaced by the base branch detected for the repository
+// When sweeping remote-tracking branches the patterns match the remote-tracking branches instead, e.g. main matches origin/main
+func resolveBaseBranches(repoName string, repo *git.Repository, options SweeperOptions) ([]*plumbing.Reference, error) {
+	patterns := []string{}
+
+	for _, pattern := range options.BaseBranches {
+		if pattern == BaseBranchAuto {
+			detected, err := detectBaseBranch(repoName, repo, options.RemoteName, options.BaseFallback, options.RemoteTracking)
+
+			if err != nil {
+				return nil, err
+			}
+
+			pattern = detected
+		}
+
+		patterns = append(patterns, remotePrefix(options)+pattern)
+	}
+
+	branches, err := sweptBranches(repoName, repo, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return findBaseBranches(repoName, branches, patterns)
+}
+
+// compileBasePatterns compiles the base branch patterns, BaseBranchAuto patterns must be resolved first
+func compileBasePatterns(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, len(patterns))
+
+	for i, pattern := range patterns {
+		g, err := CompileGlob(pattern)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid base branch pattern %q: %w", pattern, err)
+		}
+
+		globs[i] = g
+	}
+
+	return globs, nil
+}
+
+// findBaseBranches iterates through the repository branches to find the branches matching the base branch patterns
+// Branches are returned in the order of the patterns they match, at least one branch must match
+func findBaseBranches(repoName string, branches storer.ReferenceIter, patterns []string) ([]*plumbing.Reference, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s no base branch specified", repoName)
+	}
+
+	globs, err := compileBasePatterns(patterns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([][]*plumbing.Reference, len(patterns))
+
+	err = branches.ForEach(func(branch *plumbing.Reference) error {
+		for i, g := range globs {
+			if g.Match(branch.Name().Short()) {
+				matches[i] = append(matches[i], branch)
+				return nil
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s branch lookup failed: %w", repoName, err)
+	}
+
+	baseBranches := slices.Concat(matches...)
+
+	if len(baseBranches) == 0 {
+		return nil, fmt.Errorf("%s base branch %q not found", repoName, strings.Join(patterns, ","))
+	}
+
+	return baseBranches, nil
+}
@@ -0,0 +1,142 @@
+package sweeper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// DateSource selects the date that defines when a branch was last updated
+type DateSource string
+
+const (
+	// DateSourceAuthor uses the author date of the branch latest commit
+	DateSourceAuthor DateSource = "author"
+	// DateSourceCommitter uses the committer date of the branch latest commit, updated by rebases and cherry-picks
+	DateSourceCommitter DateSource = "committer"
+	// DateSourceReflog uses the last time the branch reference moved, from .git/logs/<ref>
+	// The committer date is used when the branch has no reflog
+	DateSourceReflog DateSource = "reflog"
+	// DateSourceNewestUnique uses the newest author date of the commits unique to the branch compared to the first base branch
+	// The author date of the latest commit is used when the branch has no unique commits
+	DateSourceNewestUnique DateSource = "newest-unique-commit"
+)
+
+// ParseDateSource validates a date source, an empty source defaults to DateSourceAuthor
+func ParseDateSource(source string) (DateSource, error) {
+	switch dateSource := DateSource(source); dateSource {
+	case "":
+		return DateSourceAuthor, nil
+	case DateSourceAuthor, DateSourceCommitter, DateSourceReflog, DateSourceNewestUnique:
+		return dateSource, nil
+	}
+
+	return "", fmt.Errorf("unsupported date source %q (supported: author, committer, reflog, newest-unique-commit)", source)
+}
+
+// branchDate returns the date the branch was last updated according to the source, and the source actually used
+// which differs from the requested one when falling back to a commit date
+func branchDate(repoName string, repo *git.Repository, history *baseHistory, branch *plumbing.Reference, tip *object.Commit, source DateSource) (time.Time, DateSource, error) {
+	switch source {
+	case DateSourceCommitter:
+		return tip.Committer.When, DateSourceCommitter, nil
+	case DateSourceReflog:
+		date, ok, err := reflogDate(repo, branch.Name())
+
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("%s failed to read reflog of branch %s: %w", repoName, branch.Name().Short(), err)
+		}
+
+		if !ok {
+			return tip.Committer.When, DateSourceCommitter, nil
+		}
+
+		return date, DateSourceReflog, nil
+	case DateSourceNewestUnique:
+		unique, _, err := history.uniqueCommits(repoName, branch)
+
+		if err != nil {
+			return time.Time{}, "", err
+		}
+
+		if len(unique) == 0 {
+			return tip.Author.When, DateSourceAuthor, nil
+		}
+
+		newest := unique[0].Author.When
+
+		for _, commit := range unique[1:] {
+			if commit.Author.When.After(newest) {
+				newest = commit.Author.When
+			}
+		}
+
+		return newest, DateSourceNewestUnique, nil
+	default:
+		return tip.Author.When, DateSourceAuthor, nil
+	}
+}
+
+// reflogDate returns the date of the last entry of the reference log, it reports false if there is no log
+// Every line is "<old hash> <new hash> <name> <<email>> <unix time> <timezone>\t<message>"
+func reflogDate(repo *git.Repository, name plumbing.ReferenceName) (time.Time, bool, error) {
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	file, err := os.Open(filepath.Join(dir, "logs", filepath.FromSlash(name.String())))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, false, nil
+	}
+
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	defer file.Close()
+
+	last := ""
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			last = line
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+
+	if last == "" {
+		return time.Time{}, false, nil
+	}
+
+	identity, _, _ := strings.Cut(last, "\t")
+	fields := strings.Fields(identity[strings.LastIndex(identity, ">")+1:])
+
+	if len(fields) != 2 {
+		return time.Time{}, false, fmt.Errorf("invalid reflog entry %q", last)
+	}
+
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid reflog entry %q: %w", last, err)
+	}
+
+	return time.Unix(seconds, 0), true, nil
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package sweeper
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// deviceID returns the identifier of the filesystem holding the file
+func deviceID(info fs.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Dev), true
+}
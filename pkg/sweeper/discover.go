@@ -0,0 +1,439 @@
+package sweeper
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// IgnoreFile is the name of the files listing directories to skip during the discovery, in gitignore syntax
+// Like .gitignore files their patterns apply to the directory containing them and its subdirectories
+const IgnoreFile = ".sweeperignore"
+
+// DiscoverOptions controls how repositories are found under a path
+type DiscoverOptions struct {
+	// RecurseNested continues the discovery inside the working tree of the repositories found,
+	// e.g. vendored checkouts or repositories nested in a monorepo, .git directories are never walked
+	RecurseNested bool
+	// Submodules discovers the submodules of the repositories found from their git directories in .git/modules,
+	// checked out submodules are reported at their working tree
+	Submodules bool
+	// MaxDepth limits how many directories deep the discovery goes below each path, 0 means no limit
+	MaxDepth int
+	// FollowSymlinks walks symbolic links to directories, directories reached twice are walked once
+	FollowSymlinks bool
+	// OneFilesystem doesn't walk directories on another filesystem than the path they are found under, e.g. network mounts
+	OneFilesystem bool
+	// Repositories lists the repositories to evaluate instead of walking the paths, in order, see ReadRepositories
+	// Submodules are still discovered when enabled
+	Repositories []string
+}
+
+// Kinds of discovered repositories, when several paths share the same git directory the highest kind is kept
+const (
+	kindLinkedWorktree = iota
+	kindGitDir
+	kindWorkingTree
+)
+
+// discoverer accumulates the repositories found by one or more walks
+type discoverer struct {
+	options   DiscoverOptions
+	repoPaths []string
+	errs      []error
+	// seen maps the common git directory of every repository found to its index in repoPaths, kinds holds their kind
+	seen  map[string]int
+	kinds []int
+	// visited holds the directories already walked, symbolic links resolved, so loops and overlapping paths are walked once
+	visited map[string]bool
+}
+
+// discoverRepositories walks the paths and returns the directories containing a Git repository
+// A directory is a repository when it contains a .git directory, a .git file pointing to its git directory
+// (linked worktrees, submodules, separate git directories) or when it is a bare repository itself
+// Worktrees sharing the same git directory are returned once, preferably as the main working tree
+// Walk errors don't stop the discovery and are returned along with the repositories found
+func discoverRepositories(paths []string, options DiscoverOptions) ([]string, []error, error) {
+	if options.MaxDepth < 0 {
+		return nil, nil, fmt.Errorf("max depth can't be negative")
+	}
+
+	d := &discoverer{
+		options:   options,
+		repoPaths: []string{},
+		errs:      []error{},
+		seen:      map[string]int{},
+		visited:   map[string]bool{},
+	}
+
+	if options.Repositories != nil {
+		for _, path := range options.Repositories {
+			if _, found, err := d.visitRepository(path); err != nil {
+				d.errs = append(d.errs, err)
+			} else if !found {
+				d.errs = append(d.errs, fmt.Errorf("%s is not a Git repository", path))
+			}
+		}
+
+		return d.repoPaths, d.errs, nil
+	}
+
+	for _, path := range paths {
+		if err := d.walk(path); err != nil {
+			d.errs = append(d.errs, err)
+		}
+	}
+
+	return d.repoPaths, d.errs, nil
+}
+
+// DiscoverRepositories returns the directories under paths containing a Git repository,
+// in the order of paths then in lexical order
+func DiscoverRepositories(paths []string, options DiscoverOptions) ([]string, error) {
+	repoPaths, errs, err := discoverRepositories(paths, options)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repositories on path: %w", err)
+	}
+
+	return repoPaths, errors.Join(errs...)
+}
+
+// walk discovers the repositories under root
+func (d *discoverer) walk(root string) error {
+	info, err := os.Stat(root)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	device, _ := deviceID(info)
+	d.walkDir(root, nil, device, nil)
+
+	return nil
+}
+
+// walkDir discovers the repositories in dir, rel is its path relative to the walked root, device the root filesystem
+// and ignore the patterns of the ignore files found so far
+func (d *discoverer) walkDir(dir string, rel []string, device uint64, ignore []gitignore.Pattern) {
+	real := resolvePath(dir)
+
+	if d.visited[real] {
+		return
+	}
+
+	d.visited[real] = true
+
+	kind, found, err := d.visitRepository(dir)
+
+	if err != nil {
+		d.errs = append(d.errs, err)
+		return
+	}
+
+	// A git directory only holds git internals
+	if found && (kind == kindGitDir || !d.options.RecurseNested) {
+		return
+	}
+
+	if d.options.MaxDepth > 0 && len(rel) >= d.options.MaxDepth {
+		return
+	}
+
+	patterns, err := readIgnoreFile(filepath.Join(dir, IgnoreFile), rel)
+
+	if err != nil {
+		d.errs = append(d.errs, err)
+	}
+
+	ignore = append(slices.Clip(ignore), patterns...)
+	matcher := gitignore.NewMatcher(ignore)
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		d.errs = append(d.errs, err)
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		entryRel := append(slices.Clip(rel), entry.Name())
+
+		if entry.Name() == ".git" || matcher.Match(entryRel, true) {
+			continue
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 && !d.options.FollowSymlinks {
+			continue
+		}
+
+		if !entry.IsDir() && entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		// Symbolic links are resolved, broken links and links to files are skipped
+		info, err := os.Stat(path)
+
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		if d.options.OneFilesystem {
+			if id, ok := deviceID(info); ok && id != device {
+				continue
+			}
+		}
+
+		d.walkDir(path, entryRel, device, ignore)
+	}
+}
+
+// readIgnoreFile returns the patterns of the ignore file on path, none if it doesn't exist
+// domain is the path of the directory containing it relative to the walked root
+func readIgnoreFile(path string, domain []string) ([]gitignore.Pattern, error) {
+	content, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	patterns := []gitignore.Pattern{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+
+	return patterns, nil
+}
+
+// visitRepository adds the repository on dir, with its submodules if enabled, and reports its kind
+// It reports false if dir is not a repository
+func (d *discoverer) visitRepository(dir string) (int, bool, error) {
+	gitDir, kind, err := repositoryGitDir(dir)
+
+	if err != nil || gitDir == "" {
+		return 0, false, err
+	}
+
+	common := commonGitDir(gitDir)
+	d.add(dir, common, kind)
+
+	if d.options.Submodules {
+		if err := d.walkSubmodules(common); err != nil {
+			d.errs = append(d.errs, err)
+		}
+	}
+
+	return kind, true, nil
+}
+
+// walkSubmodules discovers the submodules of the repository from their git directories, nested submodules included
+// Checked out submodules are added with their working tree, set by the core.worktree option of their git directory
+func (d *discoverer) walkSubmodules(gitDir string) error {
+	modules := filepath.Join(gitDir, "modules")
+
+	if _, err := os.Stat(modules); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return filepath.WalkDir(modules, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			d.errs = append(d.errs, walkErr)
+			return nil
+		}
+
+		if !entry.IsDir() || !isBareRepository(path) {
+			return nil
+		}
+
+		common := commonGitDir(path)
+
+		if worktree := submoduleWorktree(path); worktree != "" {
+			d.add(worktree, common, kindWorkingTree)
+		} else {
+			d.add(path, common, kindGitDir)
+		}
+
+		if err := d.walkSubmodules(path); err != nil {
+			d.errs = append(d.errs, err)
+		}
+
+		return fs.SkipDir
+	})
+}
+
+// add records the repository on path unless its git directory was already found with a higher kind
+func (d *discoverer) add(path string, common string, kind int) {
+	i, ok := d.seen[common]
+
+	if !ok {
+		d.seen[common] = len(d.repoPaths)
+		d.repoPaths = append(d.repoPaths, path)
+		d.kinds = append(d.kinds, kind)
+		return
+	}
+
+	if kind > d.kinds[i] {
+		d.repoPaths[i] = path
+		d.kinds[i] = kind
+	}
+}
+
+// repositoryGitDir returns the git directory of the repository on path, empty if path is not a repository,
+// and the kind of repository
+func repositoryGitDir(path string) (string, int, error) {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Stat(dotGit)
+
+	switch {
+	case err == nil && info.IsDir():
+		return dotGit, kindWorkingTree, nil
+	case err == nil:
+		dir, err := readGitFile(dotGit)
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		// Linked worktrees git directories point to the main git directory, submodules and separate git directories don't
+		if _, err := os.Stat(filepath.Join(dir, "commondir")); err == nil {
+			return dir, kindLinkedWorktree, nil
+		}
+
+		return dir, kindWorkingTree, nil
+	case isBareRepository(path):
+		return path, kindGitDir, nil
+	}
+
+	return "", 0, nil
+}
+
+// readGitFile returns the git directory a .git file points to with its "gitdir: <path>" line
+func readGitFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+
+	if !ok {
+		return "", fmt.Errorf("invalid git file %s: missing gitdir", path)
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+
+	return filepath.Clean(dir), nil
+}
+
+// isBareRepository reports whether path is a git directory itself, e.g. a bare mirror
+func isBareRepository(path string) bool {
+	for _, name := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(path, name)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(path, "HEAD"))
+
+	return err == nil && info.Mode().IsRegular()
+}
+
+// submoduleWorktree returns the working tree of a submodule git directory, empty if it is not checked out
+// The working tree is set by core.worktree and its .git file points back to the git directory
+func submoduleWorktree(gitDir string) string {
+	file, err := os.Open(filepath.Join(gitDir, "config"))
+
+	if err != nil {
+		return ""
+	}
+
+	defer file.Close()
+
+	cfg, err := config.ReadConfig(file)
+
+	if err != nil {
+		return ""
+	}
+
+	worktree := cfg.Raw.Section("core").Option("worktree")
+
+	if worktree == "" {
+		return ""
+	}
+
+	if !filepath.IsAbs(worktree) {
+		worktree = filepath.Join(gitDir, worktree)
+	}
+
+	worktree = filepath.Clean(worktree)
+	dir, _, err := repositoryGitDir(worktree)
+
+	if err != nil || dir == "" || commonGitDir(dir) != commonGitDir(gitDir) {
+		return ""
+	}
+
+	return worktree
+}
+
+// commonGitDir returns the git directory shared by all the worktrees of a repository
+// The git directory of a linked worktree, e.g. .git/worktrees/<name>, points to it with its commondir file
+// Symbolic links are resolved so the same repository reached by different paths is recognized
+func commonGitDir(dir string) string {
+	if content, err := os.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(content))
+
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(dir, common)
+		}
+
+		dir = common
+	}
+
+	return resolvePath(dir)
+}
+
+// resolvePath returns the absolute path with symbolic links resolved, so a directory reached by different
+// paths, relative or not, has a single key
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+
+	return filepath.Clean(path)
+}
+
+// openRepository opens the repository on path, either a working tree, a linked worktree or a bare repository
+// Linked worktrees are opened with the references of their common git directory
+func openRepository(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+}
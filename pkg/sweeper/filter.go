@@ -0,0 +1,145 @@
+package sweeper
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/gobwas/glob"
+)
+
+// branchFilter selects the branches to sweep by name with the compiled include and exclude patterns
+// A branch is swept when it matches no exclude pattern and, if there are include patterns, any of them
+type branchFilter struct {
+	include []func(name string) bool
+	exclude []func(name string) bool
+}
+
+// newBranchFilter compiles the include and exclude globs and regular expressions of the options
+func newBranchFilter(options SweeperOptions) (*branchFilter, error) {
+	include, err := compilePatterns("include", options.Include, options.IncludeRegex)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compilePatterns("exclude", options.Exclude, options.ExcludeRegex)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &branchFilter{include: include, exclude: exclude}, nil
+}
+
+// compilePatterns returns the match functions of the globs and regular expressions, empty patterns are ignored
+func compilePatterns(kind string, globs []string, regexps []string) ([]func(name string) bool, error) {
+	matchers := []func(name string) bool{}
+
+	for _, pattern := range globs {
+		if pattern == "" {
+			continue
+		}
+
+		g, err := CompileGlob(pattern)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", kind, pattern, err)
+		}
+
+		matchers = append(matchers, g.Match)
+	}
+
+	for _, pattern := range regexps {
+		if pattern == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s regular expression %q: %w", kind, pattern, err)
+		}
+
+		matchers = append(matchers, re.MatchString)
+	}
+
+	return matchers, nil
+}
+
+// CompileGlob compiles a branch glob pattern, rejecting unbalanced braces which gobwas/glob silently accepts
+func CompileGlob(pattern string, separators ...rune) (glob.Glob, error) {
+	depth := 0
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+
+		if depth < 0 {
+			return nil, fmt.Errorf("unexpected '}'")
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unclosed '{'")
+	}
+
+	return glob.Compile(pattern, separators...)
+}
+
+// SplitPatterns splits comma-separated glob patterns, e.g. main,release/*, keeping the commas of brace groups
+// such as {main,develop}, so a pattern is never cut in the middle of an alternative
+func SplitPatterns(values []string) []string {
+	patterns := []string{}
+
+	for _, value := range values {
+		depth, start := 0, 0
+
+		for i := 0; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '{':
+				depth++
+			case '}':
+				depth--
+			case ',':
+				if depth == 0 {
+					patterns = append(patterns, value[start:i])
+					start = i + 1
+				}
+			}
+		}
+
+		patterns = append(patterns, value[start:])
+	}
+
+	return slices.DeleteFunc(patterns, func(pattern string) bool { return pattern == "" })
+}
+
+// match reports whether the branch name, e.g. feature/login, is swept
+func (f *branchFilter) match(name string) bool {
+	for _, match := range f.exclude {
+		if match(name) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, match := range f.include {
+		if match(name) {
+			return true
+		}
+	}
+
+	return false
+}
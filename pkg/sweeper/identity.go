@@ -0,0 +1,138 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gobwas/glob"
+)
+
+// IdentityScope selects the commits the author and committer filters are matched against
+type IdentityScope string
+
+const (
+	// IdentityScopeTip matches the filters against the branch latest commit
+	IdentityScopeTip IdentityScope = "tip"
+	// IdentityScopeUnique matches the filters against every commit unique to the branch compared to the first base branch,
+	// the latest commit is used when the branch has no unique commits
+	IdentityScopeUnique IdentityScope = "unique"
+)
+
+// ParseIdentityScope validates an identity scope, an empty scope defaults to IdentityScopeTip
+func ParseIdentityScope(scope string) (IdentityScope, error) {
+	switch identityScope := IdentityScope(scope); identityScope {
+	case "":
+		return IdentityScopeTip, nil
+	case IdentityScopeTip, IdentityScopeUnique:
+		return identityScope, nil
+	}
+
+	return "", fmt.Errorf("unsupported identity scope %q (supported: tip, unique)", scope)
+}
+
+// identityFilter selects the branches to sweep by the author and committer of their commits
+// A commit matches when its author matches any Authors pattern, its committer any Committers pattern
+// and its author none of the AuthorsNot patterns, patterns are matched case-insensitively against the name or the email
+type identityFilter struct {
+	authors    []glob.Glob
+	committers []glob.Glob
+	authorsNot []glob.Glob
+	scope      IdentityScope
+}
+
+// newIdentityFilter compiles the identity patterns of the options
+func newIdentityFilter(options SweeperOptions) (*identityFilter, error) {
+	scope, err := ParseIdentityScope(string(options.IdentityScope))
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &identityFilter{scope: scope}
+	lists := []struct {
+		kind     string
+		patterns []string
+		globs    *[]glob.Glob
+	}{
+		{"author", options.Authors, &filter.authors},
+		{"committer", options.Committers, &filter.committers},
+		{"author-not", options.AuthorsNot, &filter.authorsNot},
+	}
+
+	for _, list := range lists {
+		for _, pattern := range list.patterns {
+			g, err := CompileGlob(strings.ToLower(pattern))
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s pattern %q: %w", list.kind, pattern, err)
+			}
+
+			*list.globs = append(*list.globs, g)
+		}
+	}
+
+	return filter, nil
+}
+
+// empty reports whether the filter has no patterns, every branch matches it
+func (f *identityFilter) empty() bool {
+	return len(f.authors) == 0 && len(f.committers) == 0 && len(f.authorsNot) == 0
+}
+
+// match reports whether the branch matches the filter, according to its scope every commit unique to the branch
+// must match, history is the base branch the unique commits are computed against
+func (f *identityFilter) match(repoName string, history *baseHistory, branch *plumbing.Reference, tip *object.Commit) (bool, error) {
+	if f.empty() {
+		return true, nil
+	}
+
+	commits := []*object.Commit{tip}
+
+	if f.scope == IdentityScopeUnique {
+		unique, _, err := history.uniqueCommits(repoName, branch)
+
+		if err != nil {
+			return false, err
+		}
+
+		if len(unique) > 0 {
+			commits = unique
+		}
+	}
+
+	for _, commit := range commits {
+		if !f.matchCommit(commit) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// matchCommit reports whether the commit author and committer match the filter
+func (f *identityFilter) matchCommit(commit *object.Commit) bool {
+	if len(f.authors) > 0 && !matchSignature(f.authors, commit.Author) {
+		return false
+	}
+
+	if len(f.committers) > 0 && !matchSignature(f.committers, commit.Committer) {
+		return false
+	}
+
+	return !matchSignature(f.authorsNot, commit.Author)
+}
+
+// matchSignature reports whether any pattern matches the signature name or email
+func matchSignature(globs []glob.Glob, signature object.Signature) bool {
+	name, email := strings.ToLower(signature.Name), strings.ToLower(signature.Email)
+
+	for _, g := range globs {
+		if g.Match(name) || g.Match(email) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,209 @@
+package sweeper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	// journalDir is the directory, inside the git directory, holding one journal file per prune run
+	journalDir = "branch-sweeper"
+	// backupRefPrefix is the namespace of the references keeping pruned commits reachable
+	backupRefPrefix = "refs/sweeper-backup/"
+)
+
+// Journal records the branches deleted from a repository during a prune run so they can be restored
+type Journal struct {
+	RunID      string         `json:"run_id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	RestoredAt *time.Time     `json:"restored_at,omitempty"`
+	Entries    []JournalEntry `json:"entries"`
+	// RepoPath, RepoName and GitDir identify the repository the journal was read from
+	RepoPath string `json:"-"`
+	RepoName string `json:"-"`
+	GitDir   string `json:"-"`
+}
+
+// JournalEntry holds everything needed to restore a single pruned branch
+type JournalEntry struct {
+	Branch         plumbing.ReferenceName `json:"branch"`
+	Hash           string                 `json:"hash"`
+	BackupRef      plumbing.ReferenceName `json:"backup_ref"`
+	UpstreamRemote string                 `json:"upstream_remote,omitempty"`
+	UpstreamMerge  plumbing.ReferenceName `json:"upstream_merge,omitempty"`
+	UpstreamRebase string                 `json:"upstream_rebase,omitempty"`
+	Remote         string                 `json:"remote,omitempty"`
+	RemoteBranch   plumbing.ReferenceName `json:"remote_branch,omitempty"`
+	RemoteHash     string                 `json:"remote_hash,omitempty"`
+	RemoteBackup   plumbing.ReferenceName `json:"remote_backup_ref,omitempty"`
+	DeletedLocal   bool                   `json:"deleted_local"`
+	DeletedRemote  bool                   `json:"deleted_remote"`
+}
+
+// Reports returns a branch report for every branch deleted during the run
+func (j Journal) Reports() []BranchReport {
+	reports := []BranchReport{}
+
+	for _, entry := range j.Entries {
+		if entry.deleted() {
+			reports = append(reports, j.report(entry))
+		}
+	}
+
+	return reports
+}
+
+// report returns the branch report of a journal entry
+func (j Journal) report(entry JournalEntry) BranchReport {
+	report := BranchReport{
+		RepoPath:      j.RepoPath,
+		RepoName:      j.RepoName,
+		GitDir:        j.GitDir,
+		Branch:        entry.Branch,
+		Hash:          plumbing.NewHash(entry.Hash),
+		Remote:        entry.Remote,
+		RemoteBranch:  entry.RemoteBranch,
+		Action:        ActionDeleted,
+		DeletedLocal:  entry.DeletedLocal,
+		DeletedRemote: entry.DeletedRemote,
+		RunID:         j.RunID,
+		BackupRef:     entry.BackupRef,
+	}
+
+	if j.RestoredAt != nil {
+		report.Action = ActionRestored
+	}
+
+	return report
+}
+
+// entry returns the entry of a branch, or nil if the branch is not part of the journal
+func (j *Journal) entry(branch plumbing.ReferenceName) *JournalEntry {
+	for i := range j.Entries {
+		if j.Entries[i].Branch == branch {
+			return &j.Entries[i]
+		}
+	}
+
+	return nil
+}
+
+// deleted reports whether the branch was deleted locally or on the remote
+func (e JournalEntry) deleted() bool {
+	return e.DeletedLocal || e.DeletedRemote
+}
+
+// NewRunID returns an identifier for a prune run, sortable by creation time, e.g. 20250626T101500.123456Z-3f9a
+// The random suffix keeps the runs started within the same microsecond apart
+func NewRunID() string {
+	return fmt.Sprintf("%s-%04x", time.Now().UTC().Format("20060102T150405.000000Z"), rand.Uint32N(1<<16))
+}
+
+// journalPath returns the path of the journal file of a run
+func journalPath(repo *git.Repository, runID string) (string, error) {
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, journalDir, runID+".json"), nil
+}
+
+// save writes the journal into the repository git directory
+func (j *Journal) save(repo *git.Repository) error {
+	path, err := journalPath(repo, j.RunID)
+
+	if err != nil {
+		return fmt.Errorf("%s failed to get journal path: %w", j.RepoName, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("%s failed to create journal directory: %w", j.RepoName, err)
+	}
+
+	content, err := json.MarshalIndent(j, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("%s failed to encode journal: %w", j.RepoName, err)
+	}
+
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("%s failed to write journal %s: %w", j.RepoName, path, err)
+	}
+
+	return nil
+}
+
+// readJournals returns the journals of a repository sorted by run ID
+func readJournals(repoPath string, repo *git.Repository) ([]Journal, error) {
+	repoName := filepath.Base(repoPath)
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get git directory: %w", repoName, err)
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, journalDir))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to list journals: %w", repoName, err)
+	}
+
+	journals := []Journal{}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, journalDir, file.Name()))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to read journal %s: %w", repoName, file.Name(), err)
+		}
+
+		journal := Journal{}
+
+		if err := json.Unmarshal(content, &journal); err != nil {
+			return nil, fmt.Errorf("%s failed to decode journal %s: %w", repoName, file.Name(), err)
+		}
+
+		journal.RepoPath = repoPath
+		journal.RepoName = repoName
+		journal.GitDir = dir
+		journals = append(journals, journal)
+	}
+
+	sortJournals(journals)
+
+	return journals, nil
+}
+
+// sortJournals orders journals by run ID, keeping the repository order within a run
+func sortJournals(journals []Journal) {
+	slices.SortStableFunc(journals, func(a, b Journal) int {
+		return strings.Compare(a.RunID, b.RunID)
+	})
+}
+
+// backupRef returns the reference keeping the commit of a pruned reference reachable
+// e.g. refs/heads/feature becomes refs/sweeper-backup/<run-id>/heads/feature
+func backupRef(runID string, name plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.ReferenceName(backupRefPrefix + runID + "/" + strings.TrimPrefix(name.String(), "refs/"))
+}
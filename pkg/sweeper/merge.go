@@ -0,0 +1,455 @@
+package sweeper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// baseHistory caches the commits reachable from a base branch
+// so checking whether many branches are merged walks the base history only once
+type baseHistory struct {
+	repo      *git.Repository
+	base      *plumbing.Reference
+	reachable map[plumbing.Hash]struct{}
+	// branches caches the commits unique to every branch tip walked so far, see uniqueCommits
+	branches map[plumbing.Hash]branchHistory
+	// patchIDs caches the patch ID of every commit diffed so far
+	patchIDs map[plumbing.Hash]string
+	// patchIDsSinceBase caches the patch IDs of the base branch commits newer than every merge base, see patchIDsSince
+	patchIDsSinceBase map[plumbing.Hash]map[string]bool
+}
+
+// branchHistory is the part of a branch history not reachable from the base branch
+type branchHistory struct {
+	unique    []*object.Commit
+	mergeBase *object.Commit
+}
+
+// newBaseHistory returns a cache for the base branch history, the history is loaded on first use
+func newBaseHistory(repo *git.Repository, base *plumbing.Reference) *baseHistory {
+	return &baseHistory{
+		repo: repo,
+		base: base,
+	}
+}
+
+// load walks the base branch history once, recording every reachable commit
+func (h *baseHistory) load(repoName string) error {
+	if h.reachable != nil {
+		return nil
+	}
+
+	baseCommit, err := h.repo.CommitObject(h.base.Hash())
+
+	if err != nil {
+		return fmt.Errorf("%s error getting base branch last commit: %w", repoName, err)
+	}
+
+	reachable := map[plumbing.Hash]struct{}{}
+
+	err = object.NewCommitPreorderIter(baseCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+		reachable[commit.Hash] = struct{}{}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s base branch commits lookup failed: %w", repoName, err)
+	}
+
+	h.reachable = reachable
+
+	return nil
+}
+
+// isMerged checks if a branch latest commit is an ancestor of (or equal to) the base branch latest commit
+func (h *baseHistory) isMerged(repoName string, branch *plumbing.Reference) (bool, error) {
+	if branch.Hash() == h.base.Hash() {
+		return true, nil
+	}
+
+	if err := h.load(repoName); err != nil {
+		return false, err
+	}
+
+	_, merged := h.reachable[branch.Hash()]
+
+	return merged, nil
+}
+
+// MergeDetection selects how the sweeper decides whether a branch is merged into the base branch
+type MergeDetection string
+
+const (
+	// MergeDetectionAncestry treats a branch as merged when its latest commit is part of the base branch history
+	MergeDetectionAncestry MergeDetection = "ancestry"
+	// MergeDetectionPatchID treats a branch as merged when every commit unique to the branch
+	// has an equivalent patch in the base branch since the merge base, like git cherry (rebase merges)
+	MergeDetectionPatchID MergeDetection = "patch-id"
+	// MergeDetectionSquash treats a branch as merged when the base branch already contains
+	// the combined changes of the branch since the merge base (squash merges)
+	MergeDetectionSquash MergeDetection = "squash"
+	// MergeDetectionAny combines all the other detection modes
+	MergeDetectionAny MergeDetection = "any"
+)
+
+// ParseMergeDetection validates a merge detection mode, an empty mode defaults to MergeDetectionAncestry
+func ParseMergeDetection(mode string) (MergeDetection, error) {
+	switch detection := MergeDetection(mode); detection {
+	case "":
+		return MergeDetectionAncestry, nil
+	case MergeDetectionAncestry, MergeDetectionPatchID, MergeDetectionSquash, MergeDetectionAny:
+		return detection, nil
+	}
+
+	return "", fmt.Errorf("unsupported merge detection %q (supported: ancestry, patch-id, squash, any)", mode)
+}
+
+// merged checks whether the branch is merged into the base branch using the detection mode
+// It returns the mode that detected the merge, or an empty mode if the branch is not merged
+func (h *baseHistory) merged(repoName string, branch *plumbing.Reference, detection MergeDetection) (MergeDetection, error) {
+	merged, err := h.isMerged(repoName, branch)
+
+	if err != nil || merged {
+		return MergeDetectionAncestry, err
+	}
+
+	if detection == MergeDetectionSquash || detection == MergeDetectionAny {
+		merged, err := h.isSquashMerged(repoName, branch)
+
+		if err != nil || merged {
+			return MergeDetectionSquash, err
+		}
+	}
+
+	if detection == MergeDetectionPatchID || detection == MergeDetectionAny {
+		merged, err := h.isPatchMerged(repoName, branch)
+
+		if err != nil || merged {
+			return MergeDetectionPatchID, err
+		}
+	}
+
+	return "", nil
+}
+
+// uniqueCommits walks the branch history until it reaches the base branch history
+// It returns the commits only reachable from the branch, newest first, and the most recent merge base
+// The result is cached by branch tip, the merge detection, the date source and the identity filters all need it
+func (h *baseHistory) uniqueCommits(repoName string, branch *plumbing.Reference) ([]*object.Commit, *object.Commit, error) {
+	if cached, ok := h.branches[branch.Hash()]; ok {
+		return cached.unique, cached.mergeBase, nil
+	}
+
+	if err := h.load(repoName); err != nil {
+		return nil, nil, err
+	}
+
+	tip, err := h.repo.CommitObject(branch.Hash())
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s error getting branch last commit: %w", repoName, err)
+	}
+
+	unique := []*object.Commit{}
+	seen := map[plumbing.Hash]bool{tip.Hash: true}
+	queue := []*object.Commit{tip}
+
+	var mergeBase *object.Commit
+
+	for len(queue) > 0 {
+		commit := queue[0]
+		queue = queue[1:]
+
+		if _, ok := h.reachable[commit.Hash]; ok {
+			if mergeBase == nil {
+				mergeBase = commit
+			}
+			continue
+		}
+
+		unique = append(unique, commit)
+
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			if !seen[parent.Hash] {
+				seen[parent.Hash] = true
+				queue = append(queue, parent)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s error getting branch commits log: %w", repoName, err)
+		}
+	}
+
+	if h.branches == nil {
+		h.branches = map[plumbing.Hash]branchHistory{}
+	}
+
+	h.branches[branch.Hash()] = branchHistory{unique: unique, mergeBase: mergeBase}
+
+	return unique, mergeBase, nil
+}
+
+// isSquashMerged checks whether applying the branch changes since the merge base to the base branch
+// leaves the base branch tree unchanged, meaning every path changed by the branch already
+// has the same content in the base branch
+func (h *baseHistory) isSquashMerged(repoName string, branch *plumbing.Reference) (bool, error) {
+	_, mergeBase, err := h.uniqueCommits(repoName, branch)
+
+	if err != nil || mergeBase == nil {
+		return false, err
+	}
+
+	trees := []*object.Tree{}
+
+	for _, hash := range []plumbing.Hash{mergeBase.Hash, branch.Hash(), h.base.Hash()} {
+		commit, err := h.repo.CommitObject(hash)
+
+		if err != nil {
+			return false, fmt.Errorf("%s error getting commit %s: %w", repoName, hash, err)
+		}
+
+		tree, err := commit.Tree()
+
+		if err != nil {
+			return false, fmt.Errorf("%s error getting commit %s tree: %w", repoName, hash, err)
+		}
+
+		trees = append(trees, tree)
+	}
+
+	mergeBaseTree, branchTree, baseTree := trees[0], trees[1], trees[2]
+
+	changes, err := object.DiffTree(mergeBaseTree, branchTree)
+
+	if err != nil {
+		return false, fmt.Errorf("%s error comparing branch %s with merge base: %w", repoName, branch.Name().Short(), err)
+	}
+
+	// A branch without changes has nothing to be squashed into the base branch
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	for _, change := range changes {
+		path := change.To.Name
+		expected := &change.To.TreeEntry
+
+		// The branch deleted the path, the base branch must not have it either
+		if path == "" {
+			path = change.From.Name
+			expected = nil
+		}
+
+		entry, err := baseTree.FindEntry(path)
+
+		if err != nil && err != object.ErrEntryNotFound && err != object.ErrDirectoryNotFound {
+			return false, fmt.Errorf("%s error looking up %s in base branch: %w", repoName, path, err)
+		}
+
+		if expected == nil && entry != nil {
+			return false, nil
+		}
+
+		if expected != nil && (entry == nil || entry.Hash != expected.Hash || entry.Mode != expected.Mode) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// isPatchMerged checks whether every commit unique to the branch has a commit with the same patch ID
+// in the base branch since the merge base, which is how rebased and cherry-picked commits are found
+// Merge commits and commits without changes are ignored
+func (h *baseHistory) isPatchMerged(repoName string, branch *plumbing.Reference) (bool, error) {
+	unique, mergeBase, err := h.uniqueCommits(repoName, branch)
+
+	if err != nil || mergeBase == nil {
+		return false, err
+	}
+
+	branchPatchIDs := []string{}
+
+	for _, commit := range unique {
+		if commit.NumParents() > 1 {
+			continue
+		}
+
+		id, err := h.patchID(repoName, commit)
+
+		if err != nil {
+			return false, err
+		}
+
+		if id != "" {
+			branchPatchIDs = append(branchPatchIDs, id)
+		}
+	}
+
+	if len(branchPatchIDs) == 0 {
+		return false, nil
+	}
+
+	basePatchIDs, err := h.patchIDsSince(repoName, mergeBase)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range branchPatchIDs {
+		if !basePatchIDs[id] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// patchIDsSince returns the patch IDs of the base branch commits newer than the merge base
+// The walk stops at the merge base and at commits committed before it, the result is cached by merge base
+// as branches created from the same base branch commit share it
+func (h *baseHistory) patchIDsSince(repoName string, mergeBase *object.Commit) (map[string]bool, error) {
+	if cached, ok := h.patchIDsSinceBase[mergeBase.Hash]; ok {
+		return cached, nil
+	}
+
+	baseCommit, err := h.repo.CommitObject(h.base.Hash())
+
+	if err != nil {
+		return nil, fmt.Errorf("%s error getting base branch last commit: %w", repoName, err)
+	}
+
+	patchIDs := map[string]bool{}
+	seen := map[plumbing.Hash]bool{baseCommit.Hash: true}
+	queue := []*object.Commit{baseCommit}
+
+	for len(queue) > 0 {
+		commit := queue[0]
+		queue = queue[1:]
+
+		if commit.Hash == mergeBase.Hash || commit.Committer.When.Before(mergeBase.Committer.When) {
+			continue
+		}
+
+		if commit.NumParents() <= 1 {
+			id, err := h.patchID(repoName, commit)
+
+			if err != nil {
+				return nil, err
+			}
+
+			patchIDs[id] = true
+		}
+
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			if !seen[parent.Hash] {
+				seen[parent.Hash] = true
+				queue = append(queue, parent)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("%s error getting base branch commits log: %w", repoName, err)
+		}
+	}
+
+	if h.patchIDsSinceBase == nil {
+		h.patchIDsSinceBase = map[plumbing.Hash]map[string]bool{}
+	}
+
+	h.patchIDsSinceBase[mergeBase.Hash] = patchIDs
+
+	return patchIDs, nil
+}
+
+// patchID returns a stable identifier of the changes introduced by a commit compared to its first parent
+// Like git patch-id it ignores whitespace and line numbers, so the same change applied on top of
+// another commit gets the same ID. Commits without changes get an empty ID
+func (h *baseHistory) patchID(repoName string, commit *object.Commit) (string, error) {
+	if id, ok := h.patchIDs[commit.Hash]; ok {
+		return id, nil
+	}
+
+	tree, err := commit.Tree()
+
+	if err != nil {
+		return "", fmt.Errorf("%s error getting commit %s tree: %w", repoName, commit.Hash, err)
+	}
+
+	var parentTree *object.Tree
+
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+
+		if err != nil {
+			return "", fmt.Errorf("%s error getting commit %s parent: %w", repoName, commit.Hash, err)
+		}
+
+		if parentTree, err = parent.Tree(); err != nil {
+			return "", fmt.Errorf("%s error getting commit %s tree: %w", repoName, parent.Hash, err)
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+
+	if err != nil {
+		return "", fmt.Errorf("%s error getting commit %s changes: %w", repoName, commit.Hash, err)
+	}
+
+	id := ""
+
+	if len(changes) > 0 {
+		patch, err := changes.Patch()
+
+		if err != nil {
+			return "", fmt.Errorf("%s error getting commit %s patch: %w", repoName, commit.Hash, err)
+		}
+
+		hasher := sha1.New()
+
+		for _, filePatch := range patch.FilePatches() {
+			from, to := filePatch.Files()
+
+			for _, file := range []diff.File{from, to} {
+				if file != nil {
+					fmt.Fprintf(hasher, "%s\x00", file.Path())
+				} else {
+					fmt.Fprint(hasher, "/dev/null\x00")
+				}
+			}
+
+			// Binary files have no chunks, their content is identified by the blob hash
+			if filePatch.IsBinary() && to != nil {
+				fmt.Fprintf(hasher, "%s\x00", to.Hash())
+			}
+
+			for _, chunk := range filePatch.Chunks() {
+				if chunk.Type() == diff.Equal {
+					continue
+				}
+
+				fmt.Fprintf(hasher, "%d%s\x00", chunk.Type(), strings.Join(strings.Fields(chunk.Content()), ""))
+			}
+		}
+
+		id = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	if h.patchIDs == nil {
+		h.patchIDs = map[plumbing.Hash]string{}
+	}
+
+	h.patchIDs[commit.Hash] = id
+
+	return id, nil
+}
@@ -0,0 +1,59 @@
+package sweeper
+
+import (
+	"fmt"
+
+	"github.com/gobwas/glob"
+)
+
+// SkipProtected is the skip reason of branches matching a protected pattern
+const SkipProtected = "protected"
+
+// DefaultProtected lists the branch patterns protected unless SweeperOptions.NoDefaultProtected is set
+var DefaultProtected = []string{"main", "master", "develop", "production", "release/*", "hotfix/*"}
+
+// protectedBranches holds the compiled protected patterns of a repository
+type protectedBranches []glob.Glob
+
+// newProtectedBranches compiles the protected patterns of the options, DefaultProtected included
+func newProtectedBranches(options SweeperOptions) (protectedBranches, error) {
+	patterns := options.Protected
+
+	if !options.NoDefaultProtected {
+		patterns = append(append([]string{}, DefaultProtected...), patterns...)
+	}
+
+	protected := protectedBranches{}
+
+	for _, pattern := range patterns {
+		g, err := CompileGlob(pattern)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid protected branch pattern %q: %w", pattern, err)
+		}
+
+		protected = append(protected, g)
+	}
+
+	return protected, nil
+}
+
+// match reports whether the branch name, e.g. release/1.0, is protected
+func (p protectedBranches) match(name string) bool {
+	for _, g := range p {
+		if g.Match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// protects reports whether the report branch or the remote branch deleted along with it is protected
+func (p protectedBranches) protects(report BranchReport) bool {
+	if !report.Branch.IsRemote() && p.match(report.BranchName()) {
+		return true
+	}
+
+	return report.RemoteBranch != "" && p.match(report.RemoteBranch.Short())
+}
@@ -0,0 +1,455 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+)
+
+// Prune deletes the branches described by reports, usually the result of a previous Sweeper call
+// It returns the reports updated with the outcome of each deletion
+// When options.DryRun is set nothing is deleted and reports are marked as ActionWouldDelete
+// Deleted branches are recorded in a per-run journal so they can be restored with Undo
+func Prune(reports []BranchReport, options SweeperOptions) ([]BranchReport, error) {
+	pruned := make([]BranchReport, 0, len(reports))
+	repos := map[string]*git.Repository{}
+	protected := map[string]protectedBranches{}
+	journals := map[string]*Journal{}
+	errs := []error{}
+
+	runID := options.RunID
+
+	if runID == "" {
+		runID = NewRunID()
+	}
+
+	for _, report := range reports {
+		if report.Action == ActionSkipped {
+			pruned = append(pruned, report)
+			continue
+		}
+
+		if options.DryRun {
+			report.Action = ActionWouldDelete
+			pruned = append(pruned, report)
+			continue
+		}
+
+		repo, ok := repos[report.RepoPath]
+
+		if !ok {
+			var err error
+
+			if repo, err = openRepository(report.RepoPath); err != nil {
+				report.Err = fmt.Errorf("could not open repository on path %s: %w", report.RepoPath, err)
+			} else {
+				repos[report.RepoPath] = repo
+			}
+		}
+
+		if _, ok := protected[report.RepoPath]; !ok && report.Err == nil {
+			// Protected patterns may be set per repository, they are resolved as when the branch was evaluated
+			repoOptions, err := repositoryOptions(report.RepoName, report.RepoPath, options)
+
+			if err == nil {
+				protected[report.RepoPath], err = newProtectedBranches(repoOptions)
+			}
+
+			if err != nil {
+				report.Err = fmt.Errorf("%s %w", report.RepoName, err)
+			}
+		}
+
+		if report.Err == nil {
+			journal, ok := journals[report.RepoPath]
+
+			if !ok {
+				journal = &Journal{
+					RunID:     runID,
+					CreatedAt: time.Now(),
+					RepoPath:  report.RepoPath,
+					RepoName:  report.RepoName,
+				}
+				journals[report.RepoPath] = journal
+			}
+
+			report.Err = pruneBranch(repo, &report, journal, protected[report.RepoPath])
+		}
+
+		if report.Action == ActionSkipped {
+			pruned = append(pruned, report)
+			continue
+		}
+
+		if report.Err != nil {
+			report.Action = ActionFailed
+			errs = append(errs, report.Err)
+		} else {
+			report.Action = ActionDeleted
+		}
+
+		pruned = append(pruned, report)
+	}
+
+	// Remote branches are deleted once the local branches are, with a single push per repository
+	errs = append(errs, pruneRemoteBranches(pruned, repos, journals, protected, options.Auth)...)
+
+	return pruned, errors.Join(errs...)
+}
+
+// pruneBranch deletes the local branch of the report, its remote counterpart is deleted later by pruneRemoteBranches
+// The branch is left untouched if it moved since it was evaluated
+// It is recorded in the journal before anything is deleted
+func pruneBranch(repo *git.Repository, report *BranchReport, journal *Journal, protected protectedBranches) error {
+	if protected.protects(*report) {
+		report.Action = ActionSkipped
+		report.SkipReason = SkipProtected
+		return nil
+	}
+
+	branch, err := repo.Reference(report.Branch, false)
+
+	if err != nil {
+		return fmt.Errorf("%s failed to get branch %s: %w", report.RepoName, report.BranchName(), err)
+	}
+
+	if branch.Hash() != report.Hash {
+		return fmt.Errorf("%s branch %s moved since it was evaluated, skipping", report.RepoName, report.BranchName())
+	}
+
+	// The branch may have been checked out since it was evaluated
+	checkedOut, err := checkedOutBranches(report.RepoName, repo)
+
+	if err != nil {
+		return err
+	}
+
+	if checkedOut[report.Branch] {
+		report.Action = ActionSkipped
+		report.SkipReason = SkipCheckedOut
+		return nil
+	}
+
+	entry, err := backupBranch(repo, report, journal.RunID)
+
+	if err != nil {
+		return err
+	}
+
+	journal.Entries = append(journal.Entries, *entry)
+	entry = &journal.Entries[len(journal.Entries)-1]
+	report.RunID = journal.RunID
+	report.BackupRef = entry.BackupRef
+
+	if err := journal.save(repo); err != nil {
+		return err
+	}
+
+	// Remote-tracking branches have no local branch, they are only deleted on the remote
+	if report.Branch.IsRemote() {
+		return nil
+	}
+
+	if err := deleteBranch(report.RepoName, repo, branch, protected); err != nil {
+		return err
+	}
+
+	report.DeletedLocal = true
+	entry.DeletedLocal = true
+
+	return journal.save(repo)
+}
+
+// pruneRemoteBranches deletes the remote branches of the pruned reports with a single push per repository and remote
+// Every report is updated with the status of its own branch in the push
+func pruneRemoteBranches(pruned []BranchReport, repos map[string]*git.Repository, journals map[string]*Journal, protected map[string]protectedBranches, auth AuthOptions) []error {
+	type batch struct {
+		repoPath string
+		remote   string
+	}
+
+	batches := []batch{}
+	indexes := map[batch][]int{}
+
+	for i, report := range pruned {
+		if report.Action != ActionDeleted || report.Remote == "" {
+			continue
+		}
+
+		key := batch{repoPath: report.RepoPath, remote: report.Remote}
+
+		if _, ok := indexes[key]; !ok {
+			batches = append(batches, key)
+		}
+
+		indexes[key] = append(indexes[key], i)
+	}
+
+	errs := []error{}
+
+	for _, key := range batches {
+		repo, journal := repos[key.repoPath], journals[key.repoPath]
+		branchNames := []string{}
+
+		for _, i := range indexes[key] {
+			branchNames = append(branchNames, pruned[i].RemoteBranch.Short())
+		}
+
+		results, err := deleteRemoteBranches(journal.RepoName, repo, key.remote, branchNames, protected[key.repoPath], auth)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, i := range indexes[key] {
+			report := &pruned[i]
+			report.Err = err
+
+			if report.Err == nil {
+				report.Err = results[report.RemoteBranch.Short()]
+
+				if report.Err != nil {
+					errs = append(errs, report.Err)
+				}
+			}
+
+			if report.Err != nil {
+				report.Action = ActionFailed
+				continue
+			}
+
+			report.DeletedRemote = true
+			journal.entry(report.Branch).DeletedRemote = true
+		}
+
+		if err := journal.save(repo); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// backupBranch keeps the branch commits reachable under refs/sweeper-backup and returns its journal entry
+// The upstream configuration and the remote-tracking branch are recorded as well
+func backupBranch(repo *git.Repository, report *BranchReport, runID string) (*JournalEntry, error) {
+	entry := &JournalEntry{
+		Branch:    report.Branch,
+		Hash:      report.Hash.String(),
+		BackupRef: backupRef(runID, report.Branch),
+	}
+
+	cfg, err := repo.Config()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to read config: %w", report.RepoName, err)
+	}
+
+	if upstream, ok := cfg.Branches[report.BranchName()]; ok {
+		entry.UpstreamRemote = upstream.Remote
+		entry.UpstreamMerge = upstream.Merge
+		entry.UpstreamRebase = upstream.Rebase
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(entry.BackupRef, report.Hash)); err != nil {
+		return nil, fmt.Errorf("%s failed to back up branch %s: %w", report.RepoName, report.BranchName(), err)
+	}
+
+	if report.Remote == "" {
+		return entry, nil
+	}
+
+	entry.Remote = report.Remote
+	entry.RemoteBranch = report.RemoteBranch
+
+	tracking, err := repo.Reference(plumbing.NewRemoteReferenceName(report.Remote, report.RemoteBranch.Short()), true)
+
+	if err == plumbing.ErrReferenceNotFound {
+		return entry, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get remote-tracking branch %s/%s: %w", report.RepoName, report.Remote, report.RemoteBranch.Short(), err)
+	}
+
+	entry.RemoteHash = tracking.Hash().String()
+	entry.RemoteBackup = backupRef(runID, tracking.Name())
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(entry.RemoteBackup, tracking.Hash())); err != nil {
+		return nil, fmt.Errorf("%s failed to back up remote-tracking branch %s/%s: %w", report.RepoName, report.Remote, report.RemoteBranch.Short(), err)
+	}
+
+	return entry, nil
+}
+
+// deleteBranch deletes a local branch from the repository, removing both its config and reference
+// Protected branches are never deleted
+func deleteBranch(repoName string, repo *git.Repository, branch *plumbing.Reference, protected protectedBranches) error {
+	if protected.match(branch.Name().Short()) {
+		return fmt.Errorf("%s branch %s is protected", repoName, branch.Name().Short())
+	}
+
+	// Delete branch .git/config, if it doesn't found the branch config it ignores the error and continues
+	if err := repo.DeleteBranch(branch.Name().Short()); err != nil && err != git.ErrBranchNotFound {
+		return fmt.Errorf("%s failed to delete branch config %s: %w", repoName, branch.Name().Short(), err)
+	}
+
+	// Delete branch .git/refs
+	if err := repo.Storer.RemoveReference(branch.Name()); err != nil {
+		return fmt.Errorf("%s failed to delete branch %s: %w", repoName, branch.Name().Short(), err)
+	}
+
+	return nil
+}
+
+// deleteRemoteBranches deletes branches from the remote repository with a single push
+// It returns the error of every branch the remote refused, branches already missing on the remote count as deleted
+// The remote-tracking branches of the deleted branches are removed as well, protected branches are never deleted
+func deleteRemoteBranches(repoName string, repo *git.Repository, remoteName string, branchNames []string, protected protectedBranches, authOptions AuthOptions) (map[string]error, error) {
+	remote, err := repo.Remote(remoteName)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get remote %s: %w", repoName, remoteName, err)
+	}
+
+	endpoint, err := remoteEndpoint(repoName, repo, remote)
+
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := remoteAuth(repoName, endpoint, authOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := receivePackSession(endpoint, auth)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to connect to remote %s: %w", repoName, remoteName, err)
+	}
+
+	defer session.Close()
+
+	advertised, err := session.AdvertisedReferences()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get references of remote %s: %w", repoName, remoteName, err)
+	}
+
+	remoteRefs, err := advertised.AllReferences()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get references of remote %s: %w", repoName, remoteName, err)
+	}
+
+	if !advertised.Capabilities.Supports(capability.DeleteRefs) {
+		return nil, fmt.Errorf("%s remote %s doesn't support deleting branches", repoName, remoteName)
+	}
+
+	request := packp.NewReferenceUpdateRequestFromCapabilities(advertised.Capabilities)
+	results := map[string]error{}
+
+	for _, branchName := range branchNames {
+		name := plumbing.NewBranchReferenceName(branchName)
+
+		if protected.match(branchName) {
+			results[branchName] = fmt.Errorf("%s remote branch %s is protected", repoName, branchName)
+			continue
+		}
+
+		if ref, ok := remoteRefs[name]; ok {
+			request.Commands = append(request.Commands, &packp.Command{Name: name, Old: ref.Hash(), New: plumbing.ZeroHash})
+		}
+	}
+
+	if len(request.Commands) > 0 {
+		status, err := session.ReceivePack(context.Background(), request)
+
+		// The status is only reported by remotes supporting the report-status capability, when a single reference is
+		// rejected the error is returned along with it, the other references are still deleted
+		if err != nil && status == nil {
+			return nil, fmt.Errorf("%s failed to delete remote branches: %w", repoName, err)
+		}
+
+		if status != nil && status.UnpackStatus != "ok" {
+			return nil, fmt.Errorf("%s failed to delete remote branches: remote %s reported %s", repoName, remoteName, status.UnpackStatus)
+		}
+
+		if status != nil {
+			for _, command := range status.CommandStatuses {
+				if command.Error() != nil {
+					results[command.ReferenceName.Short()] = fmt.Errorf("%s failed to delete remote branch %s: %s", repoName, command.ReferenceName.Short(), command.Status)
+				}
+			}
+		}
+	}
+
+	for _, branchName := range branchNames {
+		if results[branchName] != nil {
+			continue
+		}
+
+		tracking := plumbing.NewRemoteReferenceName(remoteName, branchName)
+
+		if err := repo.Storer.RemoveReference(tracking); err != nil && err != plumbing.ErrReferenceNotFound {
+			results[branchName] = fmt.Errorf("%s failed to delete remote-tracking branch %s: %w", repoName, tracking.Short(), err)
+		}
+	}
+
+	return results, nil
+}
+
+// receivePackSession opens a session to update the references of the remote repository
+func receivePackSession(endpoint *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	transportClient, err := client.NewClient(endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return transportClient.NewReceivePackSession(endpoint, auth)
+}
+
+// push pushes the refspecs to the remote repository, authenticating according to the remote URL, see remoteAuth
+func push(repoName string, repo *git.Repository, remoteName string, refSpecs []config.RefSpec, authOptions AuthOptions) error {
+	remote, err := repo.Remote(remoteName)
+
+	if err != nil {
+		return fmt.Errorf("%s failed to get remote %s: %w", repoName, remoteName, err)
+	}
+
+	endpoint, err := remoteEndpoint(repoName, repo, remote)
+
+	if err != nil {
+		return err
+	}
+
+	auth, err := remoteAuth(repoName, endpoint, authOptions)
+
+	if err != nil {
+		return err
+	}
+
+	pushOptions := &git.PushOptions{
+		RemoteURL: endpoint.String(),
+		RefSpecs:  refSpecs,
+		Auth:      auth,
+	}
+
+	if err = remote.Push(pushOptions); err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// SkipNoUpstream is the reason local branches without an upstream on a remote are not deleted on the remote
+const SkipNoUpstream = "no upstream"
+
+// upstream returns the remote and the remote branch tracked by a local branch, from branch.<name>.remote and branch.<name>.merge
+// Branches tracking another local branch (remote ".") have no upstream on a remote
+func upstream(cfg *config.Config, branch plumbing.ReferenceName) (string, plumbing.ReferenceName, bool) {
+	tracking, ok := cfg.Branches[branch.Short()]
+
+	if !ok || tracking.Remote == "" || tracking.Remote == "." || !tracking.Merge.IsBranch() {
+		return "", "", false
+	}
+
+	return tracking.Remote, tracking.Merge, true
+}
+
+// remotePrefix returns the prefix of the short names of the swept branches, e.g. origin/ for remote-tracking branches
+func remotePrefix(options SweeperOptions) string {
+	if !options.RemoteTracking {
+		return ""
+	}
+
+	return options.RemoteName + "/"
+}
+
+// sweptBranches returns the branches evaluated by the sweeper, the local branches or,
+// when options.RemoteTracking is set, the remote-tracking branches of options.RemoteName without its HEAD
+func sweptBranches(repoName string, repo *git.Repository, options SweeperOptions) (storer.ReferenceIter, error) {
+	if !options.RemoteTracking {
+		branches, err := repo.Branches()
+
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to get list of branches: %w", repoName, err)
+		}
+
+		return branches, nil
+	}
+
+	refs, err := repo.References()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get list of references: %w", repoName, err)
+	}
+
+	prefix := "refs/remotes/" + options.RemoteName + "/"
+	head := plumbing.NewRemoteHEADReferenceName(options.RemoteName)
+
+	return storer.NewReferenceFilteredIter(func(ref *plumbing.Reference) bool {
+		return ref.Type() == plumbing.HashReference && ref.Name() != head && strings.HasPrefix(ref.Name().String(), prefix)
+	}, refs), nil
+}
@@ -0,0 +1,94 @@
+package sweeper
+
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Reasons a branch can be matched by the sweeper
+const (
+	// ReasonStale means the branch was last updated before OlderThan or StaleDays
+	ReasonStale = "stale"
+	// ReasonNewerThan means the branch was last updated after NewerThan
+	ReasonNewerThan = "newer-than"
+	ReasonMerged    = "merged"
+)
+
+// Action describes what the sweeper did with a matched branch
+type Action string
+
+const (
+	// ActionNone means the branch was only listed
+	ActionNone Action = "none"
+	// ActionDeleted means the branch was deleted
+	ActionDeleted Action = "deleted"
+	// ActionWouldDelete means the branch would be deleted but the sweeper ran in dry-run mode
+	ActionWouldDelete Action = "would-delete"
+	// ActionSkipped means the branch matched but is never deleted, see BranchReport.SkipReason
+	ActionSkipped Action = "skipped"
+	// ActionRestored means the branch was restored by Undo
+	ActionRestored Action = "restored"
+	// ActionFailed means the branch could not be deleted, see BranchReport.Err
+	ActionFailed Action = "failed"
+)
+
+// BranchReport describes a branch matched by the sweeper and what was done with it
+type BranchReport struct {
+	// RepoPath is the path of the repository the branch belongs to
+	RepoPath string
+	// RepoName is the base name of RepoPath
+	RepoName string
+	// GitDir is the git directory of the repository, shared by all its worktrees
+	GitDir string
+	// Branch is the full reference name of the branch, e.g. refs/heads/feature
+	Branch plumbing.ReferenceName
+	// Hash is the hash of the branch tip commit
+	Hash plumbing.Hash
+	// Author and Committer of the branch tip commit
+	Author    object.Signature
+	Committer object.Signature
+	// LastCommit is the date used to decide whether the branch is stale
+	LastCommit time.Time
+	// DateSource is where LastCommit comes from, it may differ from the requested source when falling back to a commit date
+	DateSource DateSource
+	// Age is the time elapsed since LastCommit when the branch was evaluated
+	Age time.Duration
+	// Merged reports whether the branch is merged into the base branch
+	Merged bool
+	// MergedBy is the merge detection mode that found the branch merged, empty if not merged
+	MergedBy MergeDetection
+	// MergedInto lists the base branches the branch is merged into
+	MergedInto []string
+	// BaseBranch is the base branch the branch is merged into, or the first base branch if not merged
+	BaseBranch string
+	// Reasons lists why the branch matched the sweeper criteria
+	Reasons []string
+	// Remote and RemoteBranch identify the remote branch deleted along with the local one, if any
+	Remote       string
+	RemoteBranch plumbing.ReferenceName
+	// RemoteSkipReason explains why the remote branch is not deleted, e.g. SkipNoUpstream
+	RemoteSkipReason string
+	// UnpushedCommits is the number of commits not reachable from any remote-tracking branch or base branch,
+	// they are lost if the branch is deleted
+	UnpushedCommits int
+	// Action is what the sweeper did with the branch
+	Action Action
+	// SkipReason explains why the branch is skipped when Action is ActionSkipped
+	SkipReason string
+	// DeletedLocal and DeletedRemote report whether the branch was deleted
+	DeletedLocal  bool
+	DeletedRemote bool
+	// RunID identifies the prune run that deleted the branch, see Undo
+	RunID string
+	// BackupRef is the reference keeping the deleted branch commits reachable
+	BackupRef plumbing.ReferenceName
+	// Err holds the error that occurred while processing the branch, if any
+	Err error
+}
+
+// BranchName returns the short name of the branch, e.g. feature
+func (r BranchReport) BranchName() string {
+	return r.Branch.Short()
+}
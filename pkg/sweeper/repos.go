@@ -0,0 +1,170 @@
+package sweeper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// repoManifest is a manifest of the Google repo tool, e.g. .repo/manifests/default.xml
+type repoManifest struct {
+	Projects []struct {
+		Name string `xml:"name,attr"`
+		Path string `xml:"path,attr"`
+	} `xml:"project"`
+}
+
+// ReadRepositories reads the list of repositories in the file on path, or from stdin when path is "-",
+// it returns nil when path is empty
+// The format is detected from the content:
+//   - a JSON array of paths
+//   - a manifest of the repo tool, the path of each project, defaulting to its name
+//   - a myrepos .mrconfig, named .mrconfig or starting with a [section] after comments, the path of each section
+//   - otherwise a list of paths, one per line, blank lines and lines starting with # are ignored
+//
+// Relative paths are resolved from the directory of the file, from the directory containing .repo for repo manifests
+// and from the working directory for stdin, paths starting with ~/ from the home directory
+func ReadRepositories(path string, stdin io.Reader) ([]string, error) {
+	var content []byte
+	var err error
+	dir := "."
+
+	if path == "" {
+		return nil, nil
+	}
+
+	if path == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(path)
+		dir = filepath.Dir(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repositories list: %w", err)
+	}
+
+	var repoPaths []string
+	trimmed := bytes.TrimSpace(content)
+	first := firstLine(trimmed)
+
+	switch {
+	case strings.HasPrefix(first, "<"):
+		repoPaths, err = parseRepoManifest(trimmed)
+		dir = repoTopDir(dir)
+	case filepath.Base(path) == ".mrconfig":
+		repoPaths = parseMrConfig(trimmed)
+	case strings.HasPrefix(first, "["):
+		// A JSON array or the first section of a .mrconfig, e.g. [src/repo], which may follow comments
+		if json.Unmarshal(trimmed, &repoPaths) != nil {
+			repoPaths = parseMrConfig(trimmed)
+		}
+	default:
+		repoPaths = parseLines(trimmed)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repositories list: %w", err)
+	}
+
+	home, _ := os.UserHomeDir()
+
+	for i, repoPath := range repoPaths {
+		if rest, ok := strings.CutPrefix(repoPath, "~/"); ok && home != "" {
+			repoPath = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(repoPath) {
+			repoPath = filepath.Join(dir, repoPath)
+		}
+
+		repoPaths[i] = filepath.Clean(repoPath)
+	}
+
+	return repoPaths, nil
+}
+
+// firstLine returns the first line of the content that is neither blank nor a # comment
+func firstLine(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+
+	return ""
+}
+
+// parseRepoManifest returns the paths of the projects of a repo manifest
+func parseRepoManifest(content []byte) ([]string, error) {
+	manifest := repoManifest{}
+
+	if err := xml.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	repoPaths := []string{}
+
+	for _, project := range manifest.Projects {
+		if project.Path != "" {
+			repoPaths = append(repoPaths, project.Path)
+		} else if project.Name != "" {
+			repoPaths = append(repoPaths, project.Name)
+		}
+	}
+
+	return repoPaths, nil
+}
+
+// repoTopDir returns the directory containing the .repo directory the manifest is in, the projects are checked out there
+// It returns dir when the manifest is not in a .repo directory
+func repoTopDir(dir string) string {
+	for current := dir; ; current = filepath.Dir(current) {
+		if filepath.Base(current) == ".repo" {
+			return filepath.Dir(current)
+		}
+
+		if filepath.Dir(current) == current {
+			return dir
+		}
+	}
+}
+
+// parseMrConfig returns the paths of the sections of a myrepos configuration, the DEFAULT section excluded
+func parseMrConfig(content []byte) []string {
+	repoPaths := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		if section := strings.TrimSpace(line[1 : len(line)-1]); section != "" && section != "DEFAULT" {
+			repoPaths = append(repoPaths, section)
+		}
+	}
+
+	return repoPaths
+}
+
+// parseLines returns the paths of a list with a path per line
+func parseLines(content []byte) []string {
+	repoPaths := []string{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line != "" && !strings.HasPrefix(line, "#") {
+			repoPaths = append(repoPaths, line)
+		}
+	}
+
+	return repoPaths
+}
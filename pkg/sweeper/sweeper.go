@@ -3,279 +3,451 @@ package sweeper
 import (
 	"errors"
 	"fmt"
-	"io/fs"
-	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/storer"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
-	"github.com/gobwas/glob"
 )
 
 type SweeperOptions struct {
-	Path       string
+	Paths      []string
 	StaleDays  int
 	Merged     bool
-	BaseBranch string
 	Prune      bool
+	DryRun     bool
+	RunID      string
 	Remote     bool
 	RemoteName string
-	Include    string
-	Exclude    string
+	// Include and Exclude list glob patterns of the branches to sweep, a branch is swept when it matches
+	// no exclude pattern and any include pattern, if there are some
+	Include []string
+	Exclude []string
+	// IncludeRegex and ExcludeRegex list regular expressions matched like Include and Exclude
+	IncludeRegex []string
+	ExcludeRegex []string
+	// Authors, Committers and AuthorsNot list glob patterns matched against the name or email of the commits author
+	// and committer, see IdentityScope for the commits they are matched against
+	Authors    []string
+	Committers []string
+	AuthorsNot []string
+	// IdentityScope selects the commits matched by Authors, Committers and AuthorsNot, defaults to IdentityScopeTip
+	IdentityScope IdentityScope
+	// OlderThan and NewerThan limit the branches to those last updated before and after the given times, see ParseAge
+	// OlderThan replaces StaleDays when set, zero times are ignored
+	OlderThan time.Time
+	NewerThan time.Time
+	// DateSource selects the date that defines when a branch was last updated, defaults to DateSourceAuthor
+	DateSource DateSource
+	// BaseBranches lists the base branch names or glob patterns, BaseBranchAuto detects the base branch per repository
+	// Base branches are never swept and a branch is merged when it is merged into any of them
+	BaseBranches []string
+	// BaseFallback lists the base branches tried for BaseBranchAuto, defaults to DefaultBaseFallback
+	BaseFallback []string
+	// MergedIntoAll requires a branch to be merged into all the base branches to be considered merged
+	MergedIntoAll bool
+	// MergeDetection selects how merged branches are detected, defaults to MergeDetectionAncestry
+	MergeDetection MergeDetection
+	// Jobs is the number of repositories evaluated concurrently, defaults to the number of CPUs
+	Jobs int
+	// RemoteTracking sweeps the remote-tracking branches of RemoteName (refs/remotes/<remote>/*) instead of local branches,
+	// they are compared against the remote-tracking base branches and pruned by deleting them on the remote
+	RemoteTracking bool
+	// Auth configures how remote repositories are authenticated when deleting remote branches
+	Auth AuthOptions
+	// Force deletes local branches even if they have unpushed commits, see SkipUnpushed
+	Force bool
+	// Protected lists glob patterns of branches that are never deleted, in addition to DefaultProtected
+	// Protected branches are still reported, skipped with SkipProtected
+	Protected []string
+	// NoDefaultProtected disables the DefaultProtected patterns
+	NoDefaultProtected bool
+	// Discover controls how repositories are found under Paths
+	Discover DiscoverOptions
+	// RepoOptions returns the options of a repository, e.g. from configuration files, options apply to every repository when nil
+	RepoOptions func(repoPath string, options SweeperOptions) (SweeperOptions, error)
 }
 
-// Sweeper scans repositories in the given path and identifies branches that match the specified criteria
+// Sweeper scans repositories in the given paths and identifies branches that match the specified criteria
+// Repositories are discovered first and then evaluated concurrently by options.Jobs workers,
+// reports keep the discovery order so the output is deterministic
 // It can optionally delete (prune) identified branches
-func Sweeper(options SweeperOptions) ([][]string, error) {
-	if options.StaleDays < 0 {
-		return nil, fmt.Errorf("stale days can't be negative")
+func Sweeper(options SweeperOptions) ([]BranchReport, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
 	}
 
-	repoBranches := [][]string{}
-	errs := []error{}
+	options.MergeDetection, _ = ParseMergeDetection(string(options.MergeDetection))
+	options.DateSource, _ = ParseDateSource(string(options.DateSource))
 
-	err := filepath.WalkDir(options.Path, func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			errs = append(errs, walkErr)
-			return nil
-		}
-
-		if !d.IsDir() {
-			return nil
-		}
-
-		if d.Name() == ".git" {
-			return fs.SkipDir
-		}
+	if options.RemoteName == "" {
+		options.RemoteName = "origin"
+	}
 
-		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
-			path := filepath.Join(path)
+	repoPaths, errs, err := discoverRepositories(options.Paths, options.Discover)
 
-			repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repositories on path: %w", err)
+	}
 
-			if err != nil {
-				errs = append(errs, fmt.Errorf("could not open repository on path %s: %w", path, err))
-				return fs.SkipDir
-			}
+	jobs := options.Jobs
 
-			repoName := filepath.Base(path)
-			branches, err := repo.Branches()
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
 
-			if err != nil {
-				errs = append(errs, fmt.Errorf("%s failed to get list of branches: %w", repoName, err))
-				return fs.SkipDir
-			}
+	now := time.Now()
+	repoReports := make([][]BranchReport, len(repoPaths))
+	repoErrs := make([][]error, len(repoPaths))
+	queue := make(chan int)
 
-			baseBranch, err := findBaseBranch(repoName, branches, options.BaseBranch)
+	var wg sync.WaitGroup
 
-			if err != nil {
-				errs = append(errs, err)
-				return fs.SkipDir
-			}
+	for range min(jobs, len(repoPaths)) {
+		wg.Add(1)
 
-			// Get a new branches iterator
-			branches, err = repo.Branches()
+		go func() {
+			defer wg.Done()
 
-			if err != nil {
-				errs = append(errs, fmt.Errorf("%s failed to get list of branches: %w", repoName, err))
-				return fs.SkipDir
+			// Every worker writes only to the indexes it receives, no locking is needed
+			for i := range queue {
+				repoReports[i], repoErrs[i] = evaluateRepository(repoPaths[i], options, now)
 			}
+		}()
+	}
 
-			err = branches.ForEach(func(branch *plumbing.Reference) error {
-				if branch.Name().Short() == options.BaseBranch {
-					return nil
-				}
+	for i := range repoPaths {
+		queue <- i
+	}
 
-				if g := glob.MustCompile(options.Exclude); options.Exclude != "" && g.Match(branch.Name().Short()) {
-					return nil
-				}
+	close(queue)
+	wg.Wait()
 
-				if g := glob.MustCompile(options.Include); options.Include != "" && !g.Match(branch.Name().Short()) {
-					return nil
-				}
+	reports := []BranchReport{}
 
-				staled, err := isStale(repoName, repo, branch, options.StaleDays)
+	for i := range repoPaths {
+		reports = append(reports, repoReports[i]...)
+		errs = append(errs, repoErrs[i]...)
+	}
 
-				if err != nil {
-					errs = append(errs, err)
-					return nil
-				}
+	if options.Prune {
+		var pruneErr error
+		reports, pruneErr = Prune(reports, options)
+		errs = append(errs, pruneErr)
+	}
 
-				if !staled {
-					return nil
-				}
+	return reports, errors.Join(errs...)
+}
 
-				if options.Merged {
-					merged, err := isMerged(repoName, repo, baseBranch, branch)
+// Validate checks the options values and compiles their patterns, so invalid options are reported before any repository is scanned
+// Options returned by RepoOptions are validated when their repository is evaluated
+func (o SweeperOptions) Validate() error {
+	if o.StaleDays < 0 {
+		return fmt.Errorf("stale days can't be negative")
+	}
 
-					if err != nil {
-						errs = append(errs, err)
-						return nil
-					}
+	if !o.OlderThan.IsZero() && !o.NewerThan.IsZero() && !o.NewerThan.Before(o.OlderThan) {
+		return fmt.Errorf("newer than %s and older than %s matches no branch", o.NewerThan.Format(time.RFC3339), o.OlderThan.Format(time.RFC3339))
+	}
 
-					if !merged {
-						return nil
-					}
-				}
+	if o.Jobs < 0 {
+		return fmt.Errorf("jobs can't be negative")
+	}
 
-				if options.Prune {
-					if err := deleteBranch(repoName, repo, branch); err != nil {
-						errs = append(errs, err)
-						return nil
-					}
+	if o.Discover.MaxDepth < 0 {
+		return fmt.Errorf("max depth can't be negative")
+	}
 
-					if options.Remote {
-						if err := deleteRemoteBranch(repoName, repo, options.RemoteName, branch.Name().Short()); err != nil {
-							errs = append(errs, err)
-							return nil
-						}
-					}
-				}
+	if _, err := ParseMergeDetection(string(o.MergeDetection)); err != nil {
+		return err
+	}
 
-				repoBranches = append(repoBranches, []string{repoName, branch.Name().Short()})
+	if _, err := ParseDateSource(string(o.DateSource)); err != nil {
+		return err
+	}
 
-				return nil
-			})
+	// Detected base branches are plain names, only the given patterns can be invalid
+	basePatterns := slices.DeleteFunc(slices.Clone(o.BaseBranches), func(pattern string) bool { return pattern == BaseBranchAuto })
 
-			if err != nil {
-				errs = append(errs, fmt.Errorf("%s failed to get list of branches: %w", repoName, err))
-			}
+	if _, err := compileBasePatterns(basePatterns); err != nil {
+		return err
+	}
 
-			return fs.SkipDir
-		}
+	if _, err := newBranchFilter(o); err != nil {
+		return err
+	}
 
-		return nil
-	})
+	if _, err := newIdentityFilter(o); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan repositories on path: %w", err)
+	if _, err := newProtectedBranches(o); err != nil {
+		return err
 	}
 
-	return repoBranches, errors.Join(errs...)
+	return nil
 }
 
-// baseBranch iterates through the repository branches to find and validate the specified base branch.
-func findBaseBranch(repoName string, branches storer.ReferenceIter, optionsBaseBranch string) (*plumbing.Reference, error) {
-	var baseBranch *plumbing.Reference
+// evaluateRepository opens the repository on path and returns the branches matching the options criteria
+func evaluateRepository(path string, options SweeperOptions, now time.Time) ([]BranchReport, []error) {
+	reports := []BranchReport{}
+	errs := []error{}
 
-	err := branches.ForEach(func(branch *plumbing.Reference) error {
-		if branch.Name().Short() == optionsBaseBranch {
-			baseBranch = branch
-			return storer.ErrStop
-		}
-		return nil
-	})
+	repo, err := openRepository(path)
 
-	if err != nil && err != storer.ErrStop {
-		return nil, fmt.Errorf("%s branch lookup failed: %w", repoName, err)
+	if err != nil {
+		return nil, []error{fmt.Errorf("could not open repository on path %s: %w", path, err)}
 	}
 
-	if baseBranch == nil {
-		return nil, fmt.Errorf("%s base branch %q not found", repoName, optionsBaseBranch)
+	repoName := filepath.Base(path)
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s failed to get git directory: %w", repoName, err)}
 	}
 
-	return baseBranch, nil
-}
+	if options, err = repositoryOptions(repoName, path, options); err != nil {
+		return nil, []error{err}
+	}
 
-// isStale checks if a branch's latest commit is older than the specified number of days
-func isStale(repoName string, repo *git.Repository, branch *plumbing.Reference, staleDays int) (bool, error) {
-	commits, err := repo.Log(&git.LogOptions{From: branch.Hash()})
+	protected, err := newProtectedBranches(options)
 
 	if err != nil {
-		return false, fmt.Errorf("%s error getting branch commits log: %w", repoName, err)
+		return nil, []error{fmt.Errorf("%s %w", repoName, err)}
 	}
 
-	// Get last commit
-	commit, err := commits.Next()
+	filter, err := newBranchFilter(options)
 
 	if err != nil {
-		return false, fmt.Errorf("%s error getting branch last commit: %w", repoName, err)
+		return nil, []error{fmt.Errorf("%s %w", repoName, err)}
 	}
 
-	return time.Since(commit.Author.When) >= time.Duration(staleDays)*24*time.Hour, nil
-}
+	identity, err := newIdentityFilter(options)
 
-// isMerged checks if a branch latest commit exists in the base branch commit history
-// It compares the last commit of the branch against all commits in the base branch
-func isMerged(repoName string, repo *git.Repository, baseBranch *plumbing.Reference, branch *plumbing.Reference) (bool, error) {
-	baseBranchCommits, err := repo.Log(&git.LogOptions{From: baseBranch.Hash()})
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s %w", repoName, err)}
+	}
+
+	baseBranches, err := resolveBaseBranches(repoName, repo, options)
 
 	if err != nil {
-		return false, fmt.Errorf("%s error getting base branch commits log: %w", repoName, err)
+		return nil, []error{err}
 	}
 
-	branchCommits, err := repo.Log(&git.LogOptions{From: branch.Hash()})
+	checkedOut, err := checkedOutBranches(repoName, repo)
+
 	if err != nil {
-		return false, fmt.Errorf("%s error getting branch commits log: %w", repoName, err)
+		return nil, []error{err}
+	}
+
+	cfg, err := repo.Config()
+
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s failed to read config: %w", repoName, err)}
+	}
+
+	isBase := map[plumbing.ReferenceName]bool{}
+	histories := []*baseHistory{}
+
+	for _, baseBranch := range baseBranches {
+		isBase[baseBranch.Name()] = true
+		histories = append(histories, newBaseHistory(repo, baseBranch))
 	}
 
-	branchLastCommit, err := branchCommits.Next()
+	pushed := newPushedHistory(repo, baseBranches)
+
+	branches, err := sweptBranches(repoName, repo, options)
 
 	if err != nil {
-		return false, fmt.Errorf("%s error getting branch last commit: %w", repoName, err)
+		return nil, []error{err}
 	}
 
-	var merged bool
+	err = branches.ForEach(func(branch *plumbing.Reference) error {
+		if isBase[branch.Name()] {
+			return nil
+		}
+
+		// Remote-tracking branches are filtered by their name on the remote
+		name := strings.TrimPrefix(branch.Name().Short(), remotePrefix(options))
+
+		if !filter.match(name) {
+			return nil
+		}
+
+		commit, err := lastCommit(repoName, repo, branch)
+
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+
+		date, dateSource, err := branchDate(repoName, repo, histories[0], branch, commit, options.DateSource)
+
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+
+		if !inAgeWindow(date, options) {
+			return nil
+		}
+
+		if ok, err := identity.match(repoName, histories[0], branch, commit); err != nil || !ok {
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		}
+
+		mergedInto := []string{}
+
+		var mergedBy MergeDetection
+
+		for _, history := range histories {
+			by, err := history.merged(repoName, branch, options.MergeDetection)
+
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+
+			if by == "" {
+				continue
+			}
+
+			mergedInto = append(mergedInto, history.base.Name().Short())
+
+			if mergedBy == "" {
+				mergedBy = by
+			}
+		}
+
+		merged := len(mergedInto) > 0
+
+		if options.MergedIntoAll {
+			merged = len(mergedInto) == len(histories)
+		}
+
+		if options.Merged && !merged {
+			return nil
+		}
+
+		baseBranch := baseBranches[0].Name().Short()
+
+		if len(mergedInto) > 0 {
+			baseBranch = mergedInto[0]
+		}
+
+		report := BranchReport{
+			RepoPath:   path,
+			RepoName:   repoName,
+			GitDir:     dir,
+			Branch:     branch.Name(),
+			Hash:       branch.Hash(),
+			Author:     commit.Author,
+			Committer:  commit.Committer,
+			LastCommit: date,
+			DateSource: dateSource,
+			Age:        now.Sub(date),
+			Merged:     merged,
+			MergedBy:   mergedBy,
+			MergedInto: mergedInto,
+			BaseBranch: baseBranch,
+			Reasons:    ageReasons(options),
+			Action:     ActionNone,
+		}
+
+		if options.Merged {
+			report.Reasons = append(report.Reasons, ReasonMerged)
+		}
+
+		switch {
+		case options.RemoteTracking:
+			report.Remote = options.RemoteName
+			report.RemoteBranch = plumbing.NewBranchReferenceName(name)
+		case options.Remote:
+			// Local branches are deleted on the remote they track, which may use another name
+			if remote, remoteBranch, ok := upstream(cfg, branch.Name()); ok {
+				report.Remote = remote
+				report.RemoteBranch = remoteBranch
+			} else {
+				report.RemoteSkipReason = SkipNoUpstream
+			}
+		}
+
+		// Merged branches changes are part of a base branch even if their commits are not, e.g. after a squash merge
+		if !merged && !options.RemoteTracking {
+			// The upstream deleted along with the branch doesn't keep its commits
+			exclude := plumbing.ReferenceName("")
+
+			if report.RemoteBranch != "" {
+				exclude = plumbing.NewRemoteReferenceName(report.Remote, report.RemoteBranch.Short())
+			}
+
+			report.UnpushedCommits, err = pushed.unpushedCommits(repoName, branch, exclude)
+
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+		}
 
-	err = baseBranchCommits.ForEach(func(commit *object.Commit) error {
-		if commit.Hash == branchLastCommit.Hash {
-			merged = true
-			return storer.ErrStop
+		switch {
+		case protected.protects(report):
+			report.Action = ActionSkipped
+			report.SkipReason = SkipProtected
+		case checkedOut[branch.Name()]:
+			report.Action = ActionSkipped
+			report.SkipReason = SkipCheckedOut
+		case report.UnpushedCommits > 0 && !options.Force:
+			report.Action = ActionSkipped
+			report.SkipReason = SkipUnpushed
 		}
+
+		reports = append(reports, report)
+
 		return nil
 	})
 
-	if err != nil && err != storer.ErrStop {
-		return false, fmt.Errorf("%s base branch commits lookup failed: %w", repoName, err)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s failed to get list of branches: %w", repoName, err))
 	}
 
-	return merged, nil
+	return reports, errs
 }
 
-// deleteBranch deletes a local branch from the repository, removing both its config and reference
-func deleteBranch(repoName string, repo *git.Repository, branch *plumbing.Reference) error {
-	// Delete branch .git/config, if it doesn't found the branch config it ignores the error and continues
-	if err := repo.DeleteBranch(branch.Name().Short()); err != nil && err != git.ErrBranchNotFound {
-		return fmt.Errorf("%s failed to delete branch config %s: %w", repoName, branch.Name().Short(), err)
-	}
-
-	// Delete branch .git/refs
-	if err := repo.Storer.RemoveReference(branch.Name()); err != nil {
-		return fmt.Errorf("%s failed to delete branch %s: %w", repoName, branch.Name().Short(), err)
+// repositoryOptions returns the options of the repository on path, see SweeperOptions.RepoOptions
+func repositoryOptions(repoName string, path string, options SweeperOptions) (SweeperOptions, error) {
+	if options.RepoOptions == nil {
+		return options, nil
 	}
 
-	return nil
-}
-
-// deleteRemoteBranch deletes a branch from the remote repository using SSH authentication via ssh-agent
-func deleteRemoteBranch(repoName string, repo *git.Repository, remoteName string, branchName string) error {
-	remote, err := repo.Remote(remoteName)
+	options, err := options.RepoOptions(path, options)
 
 	if err != nil {
-		return fmt.Errorf("%s failed to get remote %s: %w", repoName, remoteName, err)
+		return options, fmt.Errorf("%s failed to get repository options: %w", repoName, err)
 	}
 
-	auth, err := ssh.NewSSHAgentAuth("git")
+	return options, nil
+}
 
-	if err != nil {
-		return fmt.Errorf("%s failed to get public key from ssh-agent: %w", repoName, err)
-	}
+// lastCommit returns the commit the branch points to
+func lastCommit(repoName string, repo *git.Repository, branch *plumbing.Reference) (*object.Commit, error) {
+	commit, err := repo.CommitObject(branch.Hash())
 
-	pushOptions := &git.PushOptions{
-		RefSpecs: []config.RefSpec{
-			config.RefSpec(":refs/heads/" + branchName),
-		},
-		Auth: auth,
+	if err != nil {
+		return nil, fmt.Errorf("%s error getting branch last commit: %w", repoName, err)
 	}
 
-	if err = remote.Push(pushOptions); err != nil && err != git.NoErrAlreadyUpToDate {
-		return fmt.Errorf("%s failed to delete remote branch: %w", repoName, err)
-	}
+	return commit, nil
+}
 
-	return nil
+// isStale checks if a branch last update, see DateSource, is older than the specified number of days
+func isStale(date time.Time, staleDays int) bool {
+	return time.Since(date) >= time.Duration(staleDays)*24*time.Hour
 }
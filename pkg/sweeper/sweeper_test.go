@@ -1,14 +1,24 @@
 package sweeper
 
 import (
+	"fmt"
+	"maps"
+	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/gobwas/glob"
 	"github.com/goombaio/namegenerator"
 )
 
@@ -18,9 +28,9 @@ func TestSweeperWithNonExistingPath(t *testing.T) {
 	path := randomName()
 
 	options := SweeperOptions{
-		Path:       path,
-		StaleDays:  30,
-		BaseBranch: defaultBaseBranch,
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{defaultBaseBranch},
 	}
 
 	repoBranches, err := Sweeper(options)
@@ -32,9 +42,9 @@ func TestSweeperWithNonExistingPath(t *testing.T) {
 
 func TestSweeperWithEmptyPath(t *testing.T) {
 	options := SweeperOptions{
-		Path:       t.TempDir(),
-		StaleDays:  30,
-		BaseBranch: defaultBaseBranch,
+		Paths:        []string{t.TempDir()},
+		StaleDays:    30,
+		BaseBranches: []string{defaultBaseBranch},
 	}
 
 	repoBranches, err := Sweeper(options)
@@ -50,9 +60,9 @@ func TestSweeperWithValidRepo(t *testing.T) {
 	_ = createTestBranch(t, repo, staledBranch, hash, time.Now().AddDate(0, 0, -30))
 
 	options := SweeperOptions{
-		Path:       path,
-		StaleDays:  30,
-		BaseBranch: "main",
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
 	}
 
 	repoBranches, err := Sweeper(options)
@@ -61,8 +71,398 @@ func TestSweeperWithValidRepo(t *testing.T) {
 		t.Errorf("Sweeper returned error: %v", err)
 	}
 
-	if !slices.Contains(repoBranches[0], staledBranch) {
-		t.Errorf("Expected branch %s", staledBranch)
+	if len(repoBranches) != 1 || repoBranches[0].BranchName() != staledBranch {
+		t.Fatalf("Expected branch %s", staledBranch)
+	}
+
+	if repoBranches[0].RepoPath != path || repoBranches[0].Hash.IsZero() {
+		t.Errorf("Expected report with repository path %s and branch hash", path)
+	}
+}
+
+func TestDiscoverRepositoriesWithWorktreesAndBareRepositories(t *testing.T) {
+	root := t.TempDir()
+	mainPath := filepath.Join(root, "b-app")
+	repo := createTestRepoOnPath(t, mainPath)
+	head, _ := repo.Head()
+	date := time.Now().AddDate(0, 0, -30)
+	_ = createTestBranch(t, repo, "feature", head.Hash(), date)
+	_ = createTestBranch(t, repo, "wip", head.Hash(), date)
+	checkoutBaseBranch(t, repo)
+
+	// A linked worktree has a .git file pointing to .git/worktrees/<name>, which points back with its commondir file
+	linkedPath := filepath.Join(root, "a-app-linked")
+	linkedGitDir := filepath.Join(mainPath, ".git", "worktrees", "linked")
+	files := map[string]string{
+		filepath.Join(linkedPath, ".git"):        "gitdir: " + linkedGitDir + "\n",
+		filepath.Join(linkedGitDir, "HEAD"):      "ref: refs/heads/wip\n",
+		filepath.Join(linkedGitDir, "commondir"): "../..\n",
+		filepath.Join(linkedGitDir, "gitdir"):    filepath.Join(linkedPath, ".git") + "\n",
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+	}
+
+	mirrorPath := filepath.Join(root, "c-mirror.git")
+
+	if _, err := git.PlainInit(mirrorPath, true); err != nil {
+		t.Fatalf("Error creating bare repository: %v", err)
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "mirror", URLs: []string{mirrorPath}}); err != nil {
+		t.Fatalf("Error creating remote: %v", err)
+	}
+
+	if err := repo.Push(&git.PushOptions{RemoteName: "mirror", RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"}}); err != nil {
+		t.Fatalf("Error pushing to bare repository: %v", err)
+	}
+
+	// A separate git directory is pointed to by a .git file without commondir
+	separatePath := filepath.Join(root, "d-separate")
+	_ = createTestRepoOnPath(t, separatePath)
+	separateGitDir := filepath.Join(t.TempDir(), "separate.git")
+
+	if err := os.Rename(filepath.Join(separatePath, ".git"), separateGitDir); err != nil {
+		t.Fatalf("Error moving git directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(separatePath, ".git"), []byte("gitdir: "+separateGitDir+"\n"), 0o644); err != nil {
+		t.Fatalf("Error writing git file: %v", err)
+	}
+
+	repoPaths, err := DiscoverRepositories([]string{root}, DiscoverOptions{})
+
+	if err != nil {
+		t.Fatalf("DiscoverRepositories returned error: %v", err)
+	}
+
+	if !slices.Equal(repoPaths, []string{mainPath, mirrorPath, separatePath}) {
+		t.Errorf("Expected main working tree, bare and separate repositories, got %v", repoPaths)
+	}
+
+	repoBranches, err := Sweeper(SweeperOptions{Paths: []string{root}, StaleDays: 30, BaseBranches: []string{"main"}})
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	branches := map[string]int{}
+
+	for _, report := range repoBranches {
+		branches[report.RepoName+"/"+report.BranchName()]++
+	}
+
+	expected := map[string]int{"b-app/feature": 1, "b-app/wip": 1, "c-mirror.git/feature": 1, "c-mirror.git/wip": 1}
+
+	if !maps.Equal(branches, expected) {
+		t.Errorf("Expected every branch once, got %v", branches)
+	}
+
+	// The linked worktree alone is opened with the branches and the git directory of the main repository
+	repoBranches, err = Sweeper(SweeperOptions{Paths: []string{linkedPath}, StaleDays: 30, BaseBranches: []string{"main"}})
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 2 {
+		t.Fatalf("Expected 2 branches from the linked worktree, got %d", len(repoBranches))
+	}
+
+	for _, report := range repoBranches {
+		if report.GitDir != commonGitDir(filepath.Join(mainPath, ".git")) {
+			t.Errorf("Expected common git directory, got %s", report.GitDir)
+		}
+
+		if report.BranchName() == "wip" && report.SkipReason != SkipCheckedOut {
+			t.Errorf("Expected branch checked out in the linked worktree to be skipped")
+		}
+	}
+}
+
+func TestDiscoverRepositoriesFromRelativePath(t *testing.T) {
+	root := t.TempDir()
+	mainPath := filepath.Join(root, "main-repo")
+	_ = createTestRepoOnPath(t, mainPath)
+
+	// The linked worktree .git file holds an absolute path, like git writes it
+	linkedPath := filepath.Join(root, "linked")
+	linkedGitDir := filepath.Join(mainPath, ".git", "worktrees", "linked")
+	files := map[string]string{
+		filepath.Join(linkedPath, ".git"):        "gitdir: " + linkedGitDir + "\n",
+		filepath.Join(linkedGitDir, "HEAD"):      "ref: refs/heads/main\n",
+		filepath.Join(linkedGitDir, "commondir"): "../..\n",
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+	}
+
+	t.Chdir(root)
+
+	// The relative and absolute paths of the same directory overlap, it is walked once
+	repoPaths, err := DiscoverRepositories([]string{".", root}, DiscoverOptions{})
+
+	if err != nil {
+		t.Fatalf("DiscoverRepositories returned error: %v", err)
+	}
+
+	if !slices.Equal(repoPaths, []string{"main-repo"}) {
+		t.Errorf("Expected the main working tree only, got %v", repoPaths)
+	}
+}
+
+func TestDiscoverNestedRepositoriesAndSubmodules(t *testing.T) {
+	root := t.TempDir()
+	appPath := filepath.Join(root, "app")
+	_ = createTestRepoOnPath(t, appPath)
+	nestedPath := filepath.Join(appPath, "vendor", "nested")
+	_ = createTestRepoOnPath(t, nestedPath)
+
+	// Submodules git directories live in .git/modules/<name>, checked out ones have a working tree pointing back to it
+	modules := filepath.Join(appPath, ".git", "modules")
+	subPath := filepath.Join(appPath, "sub")
+
+	for _, name := range []string{"sub", "removed"} {
+		module, err := git.PlainInit(filepath.Join(modules, name), true)
+
+		if err != nil {
+			t.Fatalf("Error creating submodule git directory: %v", err)
+		}
+
+		if name != "sub" {
+			continue
+		}
+
+		cfg, err := module.Config()
+
+		if err != nil {
+			t.Fatalf("Error reading submodule config: %v", err)
+		}
+
+		cfg.Raw.Section("core").SetOption("worktree", "../../../sub")
+
+		if err := module.SetConfig(cfg); err != nil {
+			t.Fatalf("Error writing submodule config: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(subPath, 0o755); err != nil {
+		t.Fatalf("Error creating submodule working tree: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(subPath, ".git"), []byte("gitdir: ../.git/modules/sub\n"), 0o644); err != nil {
+		t.Fatalf("Error writing submodule git file: %v", err)
+	}
+
+	tests := []struct {
+		options  DiscoverOptions
+		expected []string
+	}{
+		{DiscoverOptions{}, []string{appPath}},
+		{DiscoverOptions{RecurseNested: true}, []string{appPath, subPath, nestedPath}},
+		{DiscoverOptions{Submodules: true}, []string{appPath, filepath.Join(modules, "removed"), subPath}},
+		{DiscoverOptions{RecurseNested: true, Submodules: true}, []string{appPath, filepath.Join(modules, "removed"), subPath, nestedPath}},
+	}
+
+	for _, test := range tests {
+		repoPaths, err := DiscoverRepositories([]string{root}, test.options)
+
+		if err != nil {
+			t.Fatalf("DiscoverRepositories returned error: %v", err)
+		}
+
+		if !slices.Equal(repoPaths, test.expected) {
+			t.Errorf("Expected repositories %v with options %+v, got %v", test.expected, test.options, repoPaths)
+		}
+	}
+}
+
+func TestDiscoverRepositoriesWithDiscoveryControls(t *testing.T) {
+	root := t.TempDir()
+	other := t.TempDir()
+	topPath := filepath.Join(root, "top")
+	deepPath := filepath.Join(root, "a", "b", "deep")
+	ignoredPath := filepath.Join(root, "a", "node_modules", "dep")
+	otherPath := filepath.Join(other, "other")
+
+	for _, path := range []string{topPath, deepPath, ignoredPath, otherPath} {
+		_ = createTestRepoOnPath(t, path)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "a", IgnoreFile), []byte("# dependencies\nnode_modules/\n"), 0o644); err != nil {
+		t.Fatalf("Error writing ignore file: %v", err)
+	}
+
+	// The link leads to the other path and back to root, directories are walked once
+	if err := os.Symlink(other, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+
+	if err := os.Symlink(root, filepath.Join(other, "loop")); err != nil {
+		t.Fatalf("Error creating symlink: %v", err)
+	}
+
+	tests := []struct {
+		paths    []string
+		options  DiscoverOptions
+		expected []string
+	}{
+		{[]string{root}, DiscoverOptions{}, []string{deepPath, topPath}},
+		{[]string{root}, DiscoverOptions{MaxDepth: 2}, []string{topPath}},
+		{[]string{root, other, root}, DiscoverOptions{}, []string{deepPath, topPath, otherPath}},
+		{[]string{root}, DiscoverOptions{FollowSymlinks: true}, []string{deepPath, filepath.Join(root, "link", "other"), topPath}},
+		{[]string{root}, DiscoverOptions{OneFilesystem: true}, []string{deepPath, topPath}},
+	}
+
+	for _, test := range tests {
+		repoPaths, err := DiscoverRepositories(test.paths, test.options)
+
+		if err != nil {
+			t.Fatalf("DiscoverRepositories returned error: %v", err)
+		}
+
+		if !slices.Equal(repoPaths, test.expected) {
+			t.Errorf("Expected repositories %v with paths %v and options %+v, got %v", test.expected, test.paths, test.options, repoPaths)
+		}
+	}
+
+	if _, err := DiscoverRepositories([]string{root}, DiscoverOptions{MaxDepth: -1}); err == nil {
+		t.Errorf("Expected error with negative max depth")
+	}
+}
+
+func TestReadRepositories(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"repos.txt":                   "# work\napp\n\n/abs/lib\n",
+		"repos.json":                  `["app", "/abs/lib"]`,
+		".mrconfig":                   "# generated by mr register\n\n[DEFAULT]\njobs = 4\n\n[app]\ncheckout = git clone https://example.com/app.git app\n\n[/abs/lib]\n",
+		"commented.mr":                "# work repositories\n[app]\n# library\n[/abs/lib]\nupdate = git pull\n",
+		".repo/manifests/default.xml": `<manifest><remote name="origin" fetch=".."/><project name="app"/><project name="platform/lib" path="/abs/lib"/></manifest>`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Error creating directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+
+		repoPaths, err := ReadRepositories(path, nil)
+
+		if err != nil {
+			t.Fatalf("ReadRepositories returned error for %s: %v", name, err)
+		}
+
+		expected := []string{filepath.Join(dir, "app"), "/abs/lib"}
+
+		if !slices.Equal(repoPaths, expected) {
+			t.Errorf("Expected repositories %v from %s, got %v", expected, name, repoPaths)
+		}
+	}
+
+	repoPaths, err := ReadRepositories("-", strings.NewReader("app\n"))
+
+	if err != nil || !slices.Equal(repoPaths, []string{"app"}) {
+		t.Errorf("Expected repositories [app] from stdin, got %v (error %v)", repoPaths, err)
+	}
+
+	if repoPaths, err := ReadRepositories("", nil); repoPaths != nil || err != nil {
+		t.Errorf("Expected no repositories without path, got %v (error %v)", repoPaths, err)
+	}
+
+	if _, err := ReadRepositories(filepath.Join(dir, "missing"), nil); err == nil {
+		t.Errorf("Expected error with missing file")
+	}
+}
+
+func TestSweeperWithRepositoriesList(t *testing.T) {
+	root := t.TempDir()
+	firstPath := filepath.Join(root, "first")
+	secondPath := filepath.Join(root, "second")
+
+	for _, path := range []string{firstPath, secondPath} {
+		repo := createTestRepoOnPath(t, path)
+		head, _ := repo.Head()
+		createTestBranch(t, repo, "old", head.Hash(), time.Now().AddDate(0, 0, -60))
+	}
+
+	// The listed repositories are evaluated in order, the paths are not scanned
+	repoBranches, err := Sweeper(SweeperOptions{
+		Paths:        []string{t.TempDir()},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Discover:     DiscoverOptions{Repositories: []string{secondPath, filepath.Join(root, "missing"), firstPath}},
+	})
+
+	if err == nil {
+		t.Errorf("Expected error for the listed path that is not a repository")
+	}
+
+	repoPaths := []string{}
+
+	for _, report := range repoBranches {
+		repoPaths = append(repoPaths, report.RepoPath)
+	}
+
+	if !slices.Equal(repoPaths, []string{secondPath, firstPath}) {
+		t.Errorf("Expected reports of %v, got %v", []string{secondPath, firstPath}, repoPaths)
+	}
+}
+
+func TestSweeperJobsOptionKeepsOrder(t *testing.T) {
+	path := t.TempDir()
+	expected := []string{}
+
+	for i := range 8 {
+		repoPath := filepath.Join(path, fmt.Sprintf("repo-%d", i))
+		repo := createTestRepoOnPath(t, repoPath)
+		head, _ := repo.Head()
+		branchName := randomName()
+		_ = createTestBranch(t, repo, branchName, head.Hash(), time.Now().AddDate(0, 0, -30))
+		checkoutBaseBranch(t, repo)
+		expected = append(expected, repoPath+"/"+branchName)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Jobs:         4,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	found := []string{}
+
+	for _, report := range repoBranches {
+		found = append(found, report.RepoPath+"/"+report.BranchName())
+	}
+
+	if !slices.Equal(found, expected) {
+		t.Errorf("Expected branches %v, got %v", expected, found)
 	}
 }
 
@@ -73,80 +473,1306 @@ func TestSweeperIncludeOption(t *testing.T) {
 	_ = createTestBranch(t, repo, branchToInclude, hash, time.Now().AddDate(0, 0, -30))
 	_ = createTestBranch(t, repo, branchToExclude, hash, time.Now().AddDate(0, 0, -30))
 
-	options := SweeperOptions{
-		Path:       path,
-		StaleDays:  30,
-		BaseBranch: "main",
-		Include:    branchToInclude,
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Include:      []string{branchToInclude},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	for _, report := range repoBranches {
+		if report.BranchName() == branchToExclude {
+			t.Errorf("Expected only branch %s", branchToInclude)
+		}
+	}
+}
+
+func TestSweeperExcludeOption(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	branchToInclude := randomName()
+	branchToExclude := randomName()
+	_ = createTestBranch(t, repo, branchToInclude, hash, time.Now().AddDate(0, 0, -30))
+	_ = createTestBranch(t, repo, branchToExclude, hash, time.Now().AddDate(0, 0, -30))
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Exclude:      []string{branchToExclude},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	for _, report := range repoBranches {
+		if report.BranchName() == branchToExclude {
+			t.Errorf("Expected only branch %s", branchToInclude)
+		}
+	}
+}
+
+func TestSweeperWithMultiplePatterns(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+
+	for _, branch := range []string{"feat/login", "fix/crash", "fix/wip-crash", "chore/deps", "JIRA-123"} {
+		_ = createTestBranch(t, repo, branch, hash, date)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Include:      []string{"feat/*", "fix/*"},
+		IncludeRegex: []string{`^[A-Z]+-\d+$`},
+		Exclude:      []string{"*wip*"},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	names := []string{}
+
+	for _, report := range repoBranches {
+		names = append(names, report.BranchName())
+	}
+
+	slices.Sort(names)
+
+	if !slices.Equal(names, []string{"JIRA-123", "feat/login", "fix/crash"}) {
+		t.Errorf("Unexpected branches %v", names)
+	}
+}
+
+func TestSweeperWithInvalidPatterns(t *testing.T) {
+	_, path, _ := createTestRepo(t)
+
+	for _, options := range []SweeperOptions{
+		{Paths: []string{path}, BaseBranches: []string{"main"}, Include: []string{"{feat*"}},
+		{Paths: []string{path}, BaseBranches: []string{"main"}, Exclude: []string{"[fix"}},
+		{Paths: []string{path}, BaseBranches: []string{"main"}, IncludeRegex: []string{"feat("}},
+		{Paths: []string{path}, BaseBranches: []string{"main"}, Protected: []string{"[release"}},
+		{Paths: []string{path}, BaseBranches: []string{"{main"}},
+	} {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected Validate to return an error with options %+v", options)
+		}
+
+		if _, err := Sweeper(options); err == nil {
+			t.Errorf("Expected Sweeper to return an error with options %+v", options)
+		}
+	}
+}
+
+func TestSweeperWithIdentityFilters(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	_ = createTestBranch(t, repo, "mine", hash, date)
+
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		t.Fatalf("Error getting worktree: %v", err)
+	}
+
+	jane := &object.Signature{Name: "Jane Doe", Email: "jane@corp.com", When: date}
+
+	if _, err := worktree.Commit("jane commit", &git.CommitOptions{AllowEmptyCommits: true, Author: jane}); err != nil {
+		t.Fatalf("Error creating commit: %v", err)
+	}
+
+	_ = createTestBranch(t, repo, "theirs", hash, date)
+	checkoutBaseBranch(t, repo)
+
+	tests := []struct {
+		options  SweeperOptions
+		expected []string
+	}{
+		{SweeperOptions{Authors: []string{"jane*"}}, []string{"mine"}},
+		{SweeperOptions{Committers: []string{"JANE@CORP.COM"}}, []string{"mine"}},
+		{SweeperOptions{AuthorsNot: []string{"*@corp.com"}}, []string{"theirs"}},
+		{SweeperOptions{Authors: []string{"jane*"}, IdentityScope: IdentityScopeUnique}, []string{}},
+		{SweeperOptions{AuthorsNot: []string{"jane doe"}, IdentityScope: IdentityScopeUnique}, []string{"theirs"}},
+	}
+
+	for _, test := range tests {
+		options := test.options
+		options.Paths = []string{path}
+		options.StaleDays = 30
+		options.BaseBranches = []string{"main"}
+
+		repoBranches, err := Sweeper(options)
+
+		if err != nil {
+			t.Fatalf("Sweeper returned error: %v", err)
+		}
+
+		names := []string{}
+
+		for _, report := range repoBranches {
+			names = append(names, report.BranchName())
+		}
+
+		if !slices.Equal(names, test.expected) {
+			t.Errorf("Expected branches %v with options %+v, got %v", test.expected, test.options, names)
+		}
+	}
+
+	if _, err := ParseIdentityScope("all"); err == nil {
+		t.Errorf("Expected error for unsupported identity scope")
+	}
+}
+
+func TestSweeperWithDateSources(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	old := time.Now().AddDate(0, 0, -60)
+	_ = createTestBranch(t, repo, "rebased", hash, old)
+
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		t.Fatalf("Error getting worktree: %v", err)
+	}
+
+	// A rebase keeps the author date and updates the committer date
+	author := &object.Signature{Name: "Jane", Email: "jane@test.com", When: old}
+	committer := &object.Signature{Name: "Jane", Email: "jane@test.com", When: time.Now()}
+
+	if _, err := worktree.Commit("rebased commit", &git.CommitOptions{AllowEmptyCommits: true, Author: author, Committer: committer}); err != nil {
+		t.Fatalf("Error creating commit: %v", err)
+	}
+
+	moved := createTestBranch(t, repo, "moved", hash, old)
+	_ = createTestBranch(t, repo, "untouched", hash, old)
+	checkoutBaseBranch(t, repo)
+
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		t.Fatalf("Error getting git directory: %v", err)
+	}
+
+	reflog := filepath.Join(dir, "logs", "refs", "heads", "moved")
+	entry := fmt.Sprintf("%s %s Jane <jane@test.com> %d +0000\tbranch: Reset to HEAD\n", plumbing.ZeroHash, moved.Hash(), time.Now().Unix())
+
+	if err := os.MkdirAll(filepath.Dir(reflog), 0o755); err != nil {
+		t.Fatalf("Error creating reflog directory: %v", err)
+	}
+
+	if err := os.WriteFile(reflog, []byte(entry), 0o644); err != nil {
+		t.Fatalf("Error writing reflog: %v", err)
+	}
+
+	tests := []struct {
+		source   DateSource
+		expected map[string]DateSource
+	}{
+		{DateSourceAuthor, map[string]DateSource{"rebased": DateSourceAuthor, "moved": DateSourceAuthor, "untouched": DateSourceAuthor}},
+		{DateSourceCommitter, map[string]DateSource{"moved": DateSourceCommitter, "untouched": DateSourceCommitter}},
+		// Branches without reflog fall back to the committer date
+		{DateSourceReflog, map[string]DateSource{"untouched": DateSourceCommitter}},
+		{DateSourceNewestUnique, map[string]DateSource{"rebased": DateSourceNewestUnique, "moved": DateSourceNewestUnique, "untouched": DateSourceNewestUnique}},
+	}
+
+	for _, test := range tests {
+		options := SweeperOptions{
+			Paths:        []string{path},
+			StaleDays:    30,
+			BaseBranches: []string{"main"},
+			DateSource:   test.source,
+		}
+
+		repoBranches, err := Sweeper(options)
+
+		if err != nil {
+			t.Fatalf("Sweeper returned error: %v", err)
+		}
+
+		sources := map[string]DateSource{}
+
+		for _, report := range repoBranches {
+			sources[report.BranchName()] = report.DateSource
+		}
+
+		if !maps.Equal(sources, test.expected) {
+			t.Errorf("Expected stale branches %v with date source %s, got %v", test.expected, test.source, sources)
+		}
+	}
+
+	if _, err := ParseDateSource("mtime"); err == nil {
+		t.Errorf("Expected error for unsupported date source")
+	}
+}
+
+func TestSweeperRepoOptions(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	branch := randomName()
+	protected := randomName()
+	_ = createTestBranch(t, repo, branch, hash, time.Now().AddDate(0, 0, -10))
+	_ = createTestBranch(t, repo, protected, hash, time.Now().AddDate(0, 0, -10))
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		RepoOptions: func(repoPath string, options SweeperOptions) (SweeperOptions, error) {
+			options.StaleDays = 5
+			options.Protected = []string{protected}
+			return options, nil
+		},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 2 {
+		t.Fatalf("Expected 2 branches with repository options, got %d", len(repoBranches))
+	}
+
+	for _, report := range repoBranches {
+		if report.BranchName() == protected && report.SkipReason != SkipProtected {
+			t.Errorf("Expected branch %s to be skipped as protected, got %q", protected, report.SkipReason)
+		}
+	}
+}
+
+func TestSweeperNeverPrunesProtectedBranches(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	release := createTestBranch(t, repo, "release/1.0", hash, time.Now().AddDate(0, 0, -60))
+	custom := createTestBranch(t, repo, "staging", hash, time.Now().AddDate(0, 0, -60))
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+		Force:        true,
+		Protected:    []string{"stag*"},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 2 {
+		t.Fatalf("Expected 2 protected branches, got %d", len(repoBranches))
+	}
+
+	for _, report := range repoBranches {
+		if report.Action != ActionSkipped || report.SkipReason != SkipProtected {
+			t.Errorf("Expected branch %s to be skipped as protected, got %s %q", report.BranchName(), report.Action, report.SkipReason)
+		}
+	}
+
+	// Reports built by the caller don't bypass the protection
+	reports := []BranchReport{{RepoPath: path, RepoName: filepath.Base(path), Branch: release.Name(), Hash: release.Hash()}}
+
+	if reports, err = Prune(reports, options); err != nil || reports[0].SkipReason != SkipProtected {
+		t.Errorf("Expected Prune to skip protected branch: %v", err)
+	}
+
+	if err := deleteBranch(filepath.Base(path), repo, custom, protectedBranches{glob.MustCompile("stag*")}); err == nil {
+		t.Errorf("Expected deleteBranch to refuse protected branch")
+	}
+
+	remote := createTestRemote(t, repo, "main", "release/1.0")
+	protected, _ := newProtectedBranches(SweeperOptions{})
+	results, err := deleteRemoteBranches(filepath.Base(path), repo, "origin", []string{"release/1.0"}, protected, AuthOptions{})
+
+	if err != nil || results["release/1.0"] == nil {
+		t.Errorf("Expected deleteRemoteBranches to refuse protected branch: %v", err)
+	}
+
+	for _, branch := range []*plumbing.Reference{release, custom} {
+		if _, err := repo.Reference(branch.Name(), true); err != nil {
+			t.Errorf("Expected protected branch %s to exist: %v", branch.Name().Short(), err)
+		}
+	}
+
+	if _, err := remote.Reference(release.Name(), true); err != nil {
+		t.Errorf("Expected protected remote branch to exist: %v", err)
+	}
+}
+
+func TestSweeperPruneOption(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	branchToPrune := randomName()
+	_ = createTestBranch(t, repo, branchToPrune, hash, time.Now().AddDate(0, 0, -30))
+	checkoutBaseBranch(t, repo)
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || !repoBranches[0].DeletedLocal || repoBranches[0].DeletedRemote {
+		t.Fatalf("Expected branch %s to be reported as deleted locally", branchToPrune)
+	}
+
+	_, err = repo.Reference(plumbing.NewBranchReferenceName(branchToPrune), true)
+	if err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected branch %s to be removed: %v", branchToPrune, err)
+	}
+}
+
+func TestSweeperPruneRemoteTrackingBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	feature := createTestBranch(t, repo, "feature", hash, time.Now().AddDate(0, 0, -30))
+	checkoutBaseBranch(t, repo)
+	remote := createTestRemote(t, repo, "main", "feature")
+
+	if err := repo.Storer.RemoveReference(feature.Name()); err != nil {
+		t.Fatalf("Error deleting local branch: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:          []string{path},
+		StaleDays:      30,
+		BaseBranches:   []string{"main"},
+		RemoteTracking: true,
+		Prune:          true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || repoBranches[0].DeletedLocal || !repoBranches[0].DeletedRemote {
+		t.Fatalf("Expected remote-tracking branch to be reported as deleted on the remote: %v", repoBranches)
+	}
+
+	if _, err := remote.Reference(feature.Name(), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected branch to be removed from the remote: %v", err)
+	}
+
+	if _, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "feature"), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected remote-tracking branch to be removed: %v", err)
+	}
+}
+
+func TestSweeperPruneRemoteBranchesInOnePush(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	first := createTestBranch(t, repo, "first", hash, date)
+	second := createTestBranch(t, repo, "second", hash, date)
+	_ = createTestBranch(t, repo, "local-only", hash, date)
+	fix := createTestBranch(t, repo, "fix", hash, date)
+	checkoutBaseBranch(t, repo)
+	remote := createTestRemote(t, repo, "main", "first", "second")
+
+	// fix tracks a remote branch with another name
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: []config.RefSpec{"refs/heads/fix:refs/heads/users/me/fix"}}); err != nil {
+		t.Fatalf("Error pushing branch: %v", err)
+	}
+
+	setTestUpstream(t, repo, "fix", "users/me/fix")
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Remote:       true,
+		Prune:        true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 4 {
+		t.Fatalf("Expected 4 branches, got %d", len(repoBranches))
+	}
+
+	for _, report := range repoBranches {
+		if report.BranchName() == "local-only" {
+			if !report.DeletedLocal || report.DeletedRemote || report.RemoteSkipReason != SkipNoUpstream {
+				t.Errorf("Expected branch without upstream to be deleted only locally: %v", report.Err)
+			}
+
+			continue
+		}
+
+		if report.Action != ActionDeleted || !report.DeletedLocal || !report.DeletedRemote {
+			t.Errorf("Expected branch %s to be deleted locally and on the remote: %v", report.BranchName(), report.Err)
+		}
+	}
+
+	remoteBranches := []plumbing.ReferenceName{first.Name(), second.Name(), plumbing.NewBranchReferenceName("users/me/fix")}
+
+	for _, name := range remoteBranches {
+		if _, err := remote.Reference(name, true); err != plumbing.ErrReferenceNotFound {
+			t.Errorf("Expected branch %s to be removed from the remote: %v", name.Short(), err)
+		}
+	}
+
+	if _, err := remote.Reference(fix.Name(), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected no branch named after the local fix branch on the remote: %v", err)
+	}
+
+	journals, err := History([]string{path}, DiscoverOptions{})
+
+	if err != nil || len(journals) != 1 || len(journals[0].Reports()) != 4 || !journals[0].Entries[0].DeletedRemote {
+		t.Errorf("Expected remote deletions to be recorded in the journal: %v", err)
+	}
+}
+
+func TestSweeperPruneRemoteBranchesWithRejectedBranch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The update hook is a shell script")
+	}
+
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	first := createTestBranch(t, repo, "first", hash, date)
+	second := createTestBranch(t, repo, "second", hash, date)
+	checkoutBaseBranch(t, repo)
+	remote := createTestRemote(t, repo, "main", "first", "second")
+
+	// The remote refuses to update the second branch only
+	remoteConfig, _ := repo.Remote("origin")
+	hook := "#!/bin/sh\ntest \"$1\" != refs/heads/second\n"
+
+	hooks := filepath.Join(remoteConfig.Config().URLs[0], "hooks")
+
+	if err := os.MkdirAll(hooks, 0o755); err != nil {
+		t.Fatalf("Error creating hooks directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(hooks, "update"), []byte(hook), 0o755); err != nil {
+		t.Fatalf("Error writing update hook: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Remote:       true,
+		Prune:        true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err == nil || len(repoBranches) != 2 {
+		t.Fatalf("Expected an error for the rejected branch and 2 branches, got %d: %v", len(repoBranches), err)
+	}
+
+	for _, report := range repoBranches {
+		switch report.BranchName() {
+		case "first":
+			if report.Action != ActionDeleted || !report.DeletedRemote || report.Err != nil {
+				t.Errorf("Expected branch first to be deleted on the remote: %v", report.Err)
+			}
+		case "second":
+			if report.Action != ActionFailed || report.DeletedRemote || report.Err == nil {
+				t.Errorf("Expected deleting branch second on the remote to fail")
+			}
+		}
+	}
+
+	if _, err := remote.Reference(first.Name(), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected branch first to be removed from the remote: %v", err)
+	}
+
+	if _, err := remote.Reference(second.Name(), true); err != nil {
+		t.Errorf("Expected branch second to be kept on the remote: %v", err)
+	}
+
+	if _, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "first"), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected remote-tracking branch origin/first to be removed: %v", err)
+	}
+
+	if _, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "second"), true); err != nil {
+		t.Errorf("Expected remote-tracking branch origin/second to be kept: %v", err)
+	}
+
+	journals, err := History([]string{path}, DiscoverOptions{})
+
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("Expected a journal, got %d: %v", len(journals), err)
+	}
+
+	for _, entry := range journals[0].Entries {
+		if entry.DeletedRemote != (entry.Branch.Short() == "first") {
+			t.Errorf("Expected only branch first to be recorded as deleted on the remote, got %s %v", entry.Branch.Short(), entry.DeletedRemote)
+		}
+	}
+}
+
+func TestSweeperPruneRemoteBranchWithRelativeURL(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	stale := createTestBranch(t, repo, "stale", hash, date)
+	checkoutBaseBranch(t, repo)
+	remote := createTestRemote(t, repo, "main", "stale")
+
+	// The remote URL is relative to the repository, the working directory is elsewhere
+	cfg, _ := repo.Config()
+	remoteConfig := cfg.Remotes["origin"]
+	relative, err := filepath.Rel(path, remoteConfig.URLs[0])
+
+	if err != nil {
+		t.Fatalf("Error getting relative remote path: %v", err)
+	}
+
+	remoteConfig.URLs = []string{relative}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Error setting remote URL: %v", err)
+	}
+
+	// Nested so the relative URL doesn't resolve to the remote from there
+	cwd := filepath.Join(t.TempDir(), "nested", "dir")
+
+	if err := os.MkdirAll(cwd, 0o755); err != nil {
+		t.Fatalf("Error creating working directory: %v", err)
+	}
+
+	t.Chdir(cwd)
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Remote:       true,
+		Prune:        true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || !repoBranches[0].DeletedRemote {
+		t.Fatalf("Expected branch stale to be deleted on the remote: %v", repoBranches)
+	}
+
+	if _, err := remote.Reference(stale.Name(), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected branch stale to be removed from the remote: %v", err)
+	}
+
+	if _, err := Undo([]string{path}, "", AuthOptions{}, DiscoverOptions{}); err != nil {
+		t.Fatalf("Undo returned error: %v", err)
+	}
+
+	if _, err := remote.Reference(stale.Name(), true); err != nil {
+		t.Errorf("Expected branch stale to be restored on the remote: %v", err)
+	}
+}
+
+func TestSweeperSkipsBranchWithUnpushedCommits(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	pushed := createTestBranch(t, repo, "pushed", hash, date)
+	unpushed := createTestBranch(t, repo, "unpushed", hash, date)
+	checkoutBaseBranch(t, repo)
+	_ = createTestRemote(t, repo, "main", "pushed")
+
+	// Two more commits on top of the pushed branch
+	worktree, _ := repo.Worktree()
+	_ = worktree.Checkout(&git.CheckoutOptions{Branch: pushed.Name()})
+	commitTestFile(t, repo, "first.txt", "first")
+	commitTestFile(t, repo, "second.txt", "second")
+	checkoutBaseBranch(t, repo)
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    0,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	expected := map[string]int{"pushed": 2, "unpushed": 1}
+
+	for _, report := range repoBranches {
+		if report.Action != ActionSkipped || report.SkipReason != SkipUnpushed || report.UnpushedCommits != expected[report.BranchName()] {
+			t.Errorf("Expected branch %s to be skipped with %d unpushed commits, got %s %d", report.BranchName(), expected[report.BranchName()], report.Action, report.UnpushedCommits)
+		}
+	}
+
+	options.Force = true
+
+	if repoBranches, err = Sweeper(options); err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 2 || !repoBranches[0].DeletedLocal || !repoBranches[1].DeletedLocal {
+		t.Errorf("Expected branches with unpushed commits to be deleted with Force")
+	}
+
+	if _, err := repo.Reference(unpushed.Name(), true); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected branch %s to be removed: %v", unpushed.Name().Short(), err)
+	}
+}
+
+func TestSweeperRemoteDoesNotCountDeletedUpstreamAsPushed(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -30)
+	feat := createTestBranch(t, repo, "feat", hash, date)
+	shared := createTestBranch(t, repo, "shared", hash, date)
+	worktree, _ := repo.Worktree()
+
+	// Both branches have commits only found on their upstream, shared is also kept by another remote branch
+	for _, branch := range []*plumbing.Reference{feat, shared} {
+		_ = worktree.Checkout(&git.CheckoutOptions{Branch: branch.Name()})
+		commitTestFile(t, repo, branch.Name().Short()+".txt", "work")
+	}
+
+	checkoutBaseBranch(t, repo)
+	remote := createTestRemote(t, repo, "main", "feat", "shared")
+
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: []config.RefSpec{"refs/heads/shared:refs/heads/backup/shared"}}); err != nil {
+		t.Fatalf("Error pushing branch: %v", err)
+	}
+
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: "origin"}); err != nil && err != git.NoErrAlreadyUpToDate {
+		t.Fatalf("Error fetching remote: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    0,
+		BaseBranches: []string{"main"},
+	}
+
+	// Without Remote the upstreams are kept, the commits are pushed
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	for _, report := range repoBranches {
+		if report.UnpushedCommits != 0 {
+			t.Errorf("Expected no unpushed commits on branch %s, got %d", report.BranchName(), report.UnpushedCommits)
+		}
+	}
+
+	options.Remote = true
+	options.Prune = true
+
+	if repoBranches, err = Sweeper(options); err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	for _, report := range repoBranches {
+		switch report.BranchName() {
+		case "feat":
+			if report.Action != ActionSkipped || report.SkipReason != SkipUnpushed || report.UnpushedCommits != 2 {
+				t.Errorf("Expected branch feat to be skipped with 2 unpushed commits, got %s %d", report.Action, report.UnpushedCommits)
+			}
+		case "shared":
+			if report.Action != ActionDeleted || !report.DeletedLocal || !report.DeletedRemote {
+				t.Errorf("Expected branch shared to be deleted locally and on the remote: %v", report.Err)
+			}
+		}
+	}
+
+	if _, err := repo.Reference(feat.Name(), true); err != nil {
+		t.Errorf("Expected branch feat to be kept: %v", err)
+	}
+
+	if _, err := remote.Reference(feat.Name(), true); err != nil {
+		t.Errorf("Expected branch feat to be kept on the remote: %v", err)
+	}
+}
+
+func TestSweeperDryRunOption(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	branchToKeep := randomName()
+	_ = createTestBranch(t, repo, branchToKeep, hash, time.Now().AddDate(0, 0, -30))
+	checkoutBaseBranch(t, repo)
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+		DryRun:       true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || repoBranches[0].Action != ActionWouldDelete || repoBranches[0].DeletedLocal {
+		t.Fatalf("Expected branch %s to be reported as would-delete", branchToKeep)
+	}
+
+	if _, err = repo.Reference(plumbing.NewBranchReferenceName(branchToKeep), true); err != nil {
+		t.Errorf("Expected branch %s to be kept: %v", branchToKeep, err)
+	}
+}
+
+func TestPruneWithMovedBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	movedBranch := randomName()
+	_ = createTestBranch(t, repo, movedBranch, hash, time.Now().AddDate(0, 0, -30))
+	checkoutBaseBranch(t, repo)
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Force:        true,
+	}
+
+	candidates, err := Sweeper(options)
+
+	if err != nil || len(candidates) != 1 {
+		t.Fatalf("Expected branch %s to be found: %v", movedBranch, err)
+	}
+
+	// Move the branch after it was evaluated
+	err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(movedBranch), hash))
+
+	if err != nil {
+		t.Fatalf("Error moving branch %s: %v", movedBranch, err)
+	}
+
+	pruned, err := Prune(candidates, options)
+
+	if err == nil || pruned[0].Action != ActionFailed || pruned[0].DeletedLocal {
+		t.Errorf("Expected moved branch %s not to be deleted", movedBranch)
+	}
+
+	if _, err = repo.Reference(plumbing.NewBranchReferenceName(movedBranch), true); err != nil {
+		t.Errorf("Expected branch %s to be kept: %v", movedBranch, err)
+	}
+}
+
+func TestSweeperSkipsCheckedOutBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	checkedOutBranch := randomName()
+	_ = createTestBranch(t, repo, checkedOutBranch, hash, time.Now().AddDate(0, 0, -30))
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+		Force:        true,
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || repoBranches[0].Action != ActionSkipped || repoBranches[0].SkipReason != SkipCheckedOut {
+		t.Fatalf("Expected branch %s to be skipped as checked out", checkedOutBranch)
+	}
+
+	if _, err = repo.Reference(plumbing.NewBranchReferenceName(checkedOutBranch), true); err != nil {
+		t.Errorf("Expected branch %s to be kept: %v", checkedOutBranch, err)
+	}
+}
+
+func TestCheckedOutBranchesWithLinkedWorktree(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	worktreeBranch := randomName()
+	_ = createTestBranch(t, repo, worktreeBranch, hash, time.Now())
+	checkoutBaseBranch(t, repo)
+
+	// Linked worktrees store their HEAD in .git/worktrees/<name>/HEAD
+	worktreeDir := filepath.Join(path, ".git", "worktrees", "linked")
+
+	if err := os.MkdirAll(worktreeDir, 0o755); err != nil {
+		t.Fatalf("Error creating worktree directory: %v", err)
+	}
+
+	head := "ref: " + plumbing.NewBranchReferenceName(worktreeBranch).String() + "\n"
+
+	if err := os.WriteFile(filepath.Join(worktreeDir, "HEAD"), []byte(head), 0o644); err != nil {
+		t.Fatalf("Error writing worktree HEAD: %v", err)
+	}
+
+	checkedOut, err := checkedOutBranches(filepath.Base(path), repo)
+
+	if err != nil {
+		t.Errorf("checkedOutBranches returned error: %v", err)
+	}
+
+	if !checkedOut[plumbing.NewBranchReferenceName(defaultBaseBranch)] || !checkedOut[plumbing.NewBranchReferenceName(worktreeBranch)] {
+		t.Errorf("Expected %s and %s to be checked out, got %v", defaultBaseBranch, worktreeBranch, checkedOut)
+	}
+}
+
+func TestUndoRestoresPrunedBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	branchToRestore := randomName()
+	branch := createTestBranch(t, repo, branchToRestore, hash, time.Now().AddDate(0, 0, -30))
+	checkoutBaseBranch(t, repo)
+
+	err := repo.CreateBranch(&config.Branch{
+		Name:   branchToRestore,
+		Remote: "origin",
+		Merge:  plumbing.NewBranchReferenceName(branchToRestore),
+	})
+
+	if err != nil {
+		t.Fatalf("Error creating branch config: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{"main"},
+		Prune:        true,
+		Force:        true,
+		RunID:        "run-1",
+	}
+
+	if _, err := Sweeper(options); err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	history, err := History([]string{path}, DiscoverOptions{})
+
+	if err != nil {
+		t.Errorf("History returned error: %v", err)
+	}
+
+	if len(history) != 1 || history[0].RunID != "run-1" || len(history[0].Reports()) != 1 {
+		t.Fatalf("Expected a single prune run with one branch, got %v", history)
+	}
+
+	restored, err := Undo([]string{path}, "", AuthOptions{}, DiscoverOptions{})
+
+	if err != nil {
+		t.Errorf("Undo returned error: %v", err)
+	}
+
+	if len(restored) != 1 || restored[0].Action != ActionRestored {
+		t.Fatalf("Expected branch %s to be restored", branchToRestore)
+	}
+
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branchToRestore), true)
+
+	if err != nil || ref.Hash() != branch.Hash() {
+		t.Errorf("Expected branch %s to point to %s: %v", branchToRestore, branch.Hash(), err)
+	}
+
+	cfg, _ := repo.Config()
+
+	if upstream, ok := cfg.Branches[branchToRestore]; !ok || upstream.Remote != "origin" {
+		t.Errorf("Expected branch %s upstream config to be restored", branchToRestore)
+	}
+
+	if _, err := repo.Reference(backupRef("run-1", branch.Name()), false); err != plumbing.ErrReferenceNotFound {
+		t.Errorf("Expected backup reference to be removed: %v", err)
+	}
+
+	if _, err := Undo([]string{path}, "run-1", AuthOptions{}, DiscoverOptions{}); err == nil {
+		t.Errorf("Expected error when restoring run twice")
+	}
+}
+
+func TestNewRunIDIsUniqueAndSortable(t *testing.T) {
+	ids := []string{}
+
+	for range 100 {
+		ids = append(ids, NewRunID())
+	}
+
+	// Runs started within the same second must not share their journal and backup refs
+	if len(slices.Compact(slices.Sorted(slices.Values(ids)))) != len(ids) {
+		t.Errorf("Expected unique run IDs, got %v", ids)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	if later := NewRunID(); later < slices.Max(ids) {
+		t.Errorf("Expected run ID %s to sort after %s", later, slices.Max(ids))
+	}
+}
+
+func TestBaseBranchWithValidBranch(t *testing.T) {
+	repo, path, _ := createTestRepo(t)
+	repoName := filepath.Base(path)
+
+	branches, _ := repo.Branches()
+
+	baseBranches, err := findBaseBranches(repoName, branches, []string{defaultBaseBranch})
+
+	if err != nil {
+		t.Fatalf("findBaseBranches returned error: %v", err)
+	}
+
+	if len(baseBranches) != 1 || baseBranches[0].Name().Short() != defaultBaseBranch {
+		t.Errorf("Expected base branch: %s", defaultBaseBranch)
+	}
+}
+
+func TestBaseBranchWithInvalidBranch(t *testing.T) {
+	repo, path, _ := createTestRepo(t)
+	repoName := filepath.Base(path)
+
+	branches, _ := repo.Branches()
+
+	_, err := findBaseBranches(repoName, branches, []string{"test"})
+
+	if err == nil {
+		t.Errorf("Expected empty result")
+	}
+}
+
+func TestDetectBaseBranchFromRemoteHead(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	_ = createTestBranch(t, repo, "develop", hash, time.Now())
+
+	remoteHead := plumbing.NewSymbolicReference(
+		plumbing.NewRemoteHEADReferenceName("origin"),
+		plumbing.NewRemoteReferenceName("origin", "develop"),
+	)
+
+	if err := repo.Storer.SetReference(remoteHead); err != nil {
+		t.Fatalf("Error creating remote HEAD: %v", err)
+	}
+
+	baseBranch, err := detectBaseBranch(filepath.Base(path), repo, "origin", nil, false)
+
+	if err != nil {
+		t.Errorf("detectBaseBranch returned error: %v", err)
+	}
+
+	if baseBranch != "develop" {
+		t.Errorf("Expected base branch develop, got %s", baseBranch)
+	}
+}
+
+func TestDetectBaseBranchFromFallback(t *testing.T) {
+	repo, path, _ := createTestRepo(t)
+
+	baseBranch, err := detectBaseBranch(filepath.Base(path), repo, "origin", []string{"trunk", defaultBaseBranch}, false)
+
+	if err != nil {
+		t.Errorf("detectBaseBranch returned error: %v", err)
+	}
+
+	if baseBranch != defaultBaseBranch {
+		t.Errorf("Expected base branch %s, got %s", defaultBaseBranch, baseBranch)
+	}
+
+	if _, err := detectBaseBranch(filepath.Base(path), repo, "origin", []string{"trunk"}, false); err == nil {
+		t.Errorf("Expected error when no base branch candidate exists")
+	}
+}
+
+func TestSweeperWithAutoBaseBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	staledBranch := randomName()
+	_ = createTestBranch(t, repo, staledBranch, hash, time.Now().AddDate(0, 0, -30))
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{BaseBranchAuto},
+		BaseFallback: []string{"trunk", defaultBaseBranch},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Errorf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || repoBranches[0].BaseBranch != defaultBaseBranch {
+		t.Errorf("Expected branch %s compared against detected base branch %s", staledBranch, defaultBaseBranch)
+	}
+}
+
+func TestSweeperWithMultipleBaseBranches(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -60)
+	_ = createTestBranch(t, repo, "release/2.0", hash, date)
+	feature := createTestBranch(t, repo, "feature", hash, date)
+	checkoutBaseBranch(t, repo)
+
+	// release/1.0 contains the feature branch while main does not
+	release := plumbing.NewHashReference(plumbing.NewBranchReferenceName("release/1.0"), feature.Hash())
+
+	if err := repo.Storer.SetReference(release); err != nil {
+		t.Fatalf("Error creating release branch: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		BaseBranches: []string{defaultBaseBranch, "release/*"},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 || repoBranches[0].BranchName() != "feature" {
+		t.Fatalf("Expected only feature branch, base branches must be protected: %v", repoBranches)
+	}
+
+	if !repoBranches[0].Merged || repoBranches[0].BaseBranch != "release/1.0" || !slices.Equal(repoBranches[0].MergedInto, []string{"release/1.0"}) {
+		t.Errorf("Expected feature branch merged into release/1.0, got %v", repoBranches[0].MergedInto)
+	}
+
+	options.Merged = true
+	options.MergedIntoAll = true
+
+	if repoBranches, err = Sweeper(options); err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 0 {
+		t.Errorf("Expected no branch merged into all base branches, got %d", len(repoBranches))
+	}
+}
+
+func TestBaseBranchWithoutMatchingPattern(t *testing.T) {
+	repo, path, _ := createTestRepo(t)
+	repoName := filepath.Base(path)
+
+	branches, _ := repo.Branches()
+
+	baseBranches, err := findBaseBranches(repoName, branches, []string{"release/*", defaultBaseBranch})
+
+	if err != nil {
+		t.Fatalf("findBaseBranches returned error: %v", err)
+	}
+
+	if len(baseBranches) != 1 {
+		t.Errorf("Expected patterns without matches to be ignored, got %d base branches", len(baseBranches))
+	}
+
+	branches, _ = repo.Branches()
+
+	if _, err := findBaseBranches(repoName, branches, []string{"release/*"}); err == nil {
+		t.Errorf("Expected error when no base branch matches")
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	tests := map[string]struct {
+		values   []string
+		expected []string
+	}{
+		"comma-separated": {[]string{"main,release/*"}, []string{"main", "release/*"}},
+		"repeated":        {[]string{"main", "release/*"}, []string{"main", "release/*"}},
+		"brace group":     {[]string{"{main,develop},release/{1,2}.*"}, []string{"{main,develop}", "release/{1,2}.*"}},
+		"escaped brace":   {[]string{`a\{b,c`}, []string{`a\{b`, "c"}},
+		"empty patterns":  {[]string{"main,,", ""}, []string{"main"}},
+	}
+
+	for name, test := range tests {
+		if patterns := SplitPatterns(test.values); !slices.Equal(patterns, test.expected) {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, patterns)
+		}
+	}
+}
+
+func TestSweeperWithRemoteTrackingBranches(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	date := time.Now().AddDate(0, 0, -60)
+	feature := createTestBranch(t, repo, "feature", hash, date)
+	_ = createTestBranch(t, repo, "local-only", hash, date)
+	checkoutBaseBranch(t, repo)
+
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", defaultBaseBranch), hash),
+		plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "feature"), feature.Hash()),
+		plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName("origin"), plumbing.NewRemoteReferenceName("origin", defaultBaseBranch)),
+	}
+
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			t.Fatalf("Error creating remote-tracking branch: %v", err)
+		}
+	}
+
+	if err := repo.Storer.RemoveReference(feature.Name()); err != nil {
+		t.Fatalf("Error deleting local branch: %v", err)
+	}
+
+	options := SweeperOptions{
+		Paths:          []string{path},
+		StaleDays:      30,
+		BaseBranches:   []string{BaseBranchAuto},
+		RemoteTracking: true,
+		Include:        []string{"feat*"},
+	}
+
+	repoBranches, err := Sweeper(options)
+
+	if err != nil {
+		t.Fatalf("Sweeper returned error: %v", err)
+	}
+
+	if len(repoBranches) != 1 {
+		t.Fatalf("Expected only the remote-tracking feature branch, got %d branches", len(repoBranches))
+	}
+
+	report := repoBranches[0]
+
+	if report.BranchName() != "origin/feature" || report.Remote != "origin" || report.RemoteBranch.Short() != "feature" {
+		t.Errorf("Unexpected remote-tracking branch report: %s %s %s", report.BranchName(), report.Remote, report.RemoteBranch)
+	}
+
+	if report.BaseBranch != "origin/"+defaultBaseBranch {
+		t.Errorf("Expected branch compared against origin/%s, got %s", defaultBaseBranch, report.BaseBranch)
+	}
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".netrc")
+	content := "machine example.com login jane password secret\ndefault login anonymous password guest\n"
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Error writing netrc: %v", err)
+	}
+
+	if login, password, ok := netrcCredentials(path, "example.com"); !ok || login != "jane" || password != "secret" {
+		t.Errorf("Unexpected example.com credentials: %s %s", login, password)
+	}
+
+	if login, password, ok := netrcCredentials(path, "other.com"); !ok || login != "anonymous" || password != "guest" {
+		t.Errorf("Expected default credentials, got %s %s", login, password)
 	}
 
-	repoBranches, err := Sweeper(options)
+	if _, _, ok := netrcCredentials(filepath.Join(t.TempDir(), "missing"), "example.com"); ok {
+		t.Errorf("Expected no credentials without netrc file")
+	}
+}
 
-	if err != nil {
-		t.Errorf("Sweeper returned error: %v", err)
+func TestParseCredential(t *testing.T) {
+	username, password, ok := parseCredential([]byte("protocol=https\nhost=example.com\nusername=jane\npassword=a=b\n"))
+
+	if !ok || username != "jane" || password != "a=b" {
+		t.Errorf("Unexpected credentials: %s %s", username, password)
 	}
 
-	for _, branches := range repoBranches {
-		if slices.Contains(branches, branchToExclude) {
-			t.Errorf("Expected only branch %s", branchToInclude)
-		}
+	if _, _, ok := parseCredential([]byte("protocol=https\nhost=example.com\n")); ok {
+		t.Errorf("Expected no credentials without password")
 	}
 }
 
-func TestSweeperExcludeOption(t *testing.T) {
-	repo, path, hash := createTestRepo(t)
-	branchToInclude := randomName()
-	branchToExclude := randomName()
-	_ = createTestBranch(t, repo, branchToInclude, hash, time.Now().AddDate(0, 0, -30))
-	_ = createTestBranch(t, repo, branchToExclude, hash, time.Now().AddDate(0, 0, -30))
+func TestHTTPAuthSendsGitHubTokenOnlyToGitHub(t *testing.T) {
+	setTestCredentialsEnv(t)
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	t.Setenv("GITHUB_SERVER_URL", "https://GHE.example.com")
 
-	options := SweeperOptions{
-		Path:       path,
-		StaleDays:  30,
-		BaseBranch: "main",
-		Exclude:    branchToExclude,
+	for _, host := range []string{"github.com", "ghe.example.com"} {
+		auth := httpAuth(&transport.Endpoint{Protocol: "https", Host: host, Path: "/org/repo.git"})
+
+		if basic, ok := auth.(*http.BasicAuth); !ok || basic.Password != "github-token" {
+			t.Errorf("Expected GitHub token for %s, got %v", host, auth)
+		}
 	}
 
-	repoBranches, err := Sweeper(options)
+	endpoint := &transport.Endpoint{Protocol: "https", Host: "gitlab.com", Path: "/org/repo.git"}
 
-	if err != nil {
-		t.Errorf("Sweeper returned error: %v", err)
+	if auth := httpAuth(endpoint); auth != nil {
+		t.Errorf("Expected no credentials for a host other than GitHub, got %v", auth)
 	}
 
-	for _, branches := range repoBranches {
-		if slices.Contains(branches, branchToExclude) {
-			t.Errorf("Expected only branch %s", branchToInclude)
-		}
+	t.Setenv("GIT_TOKEN", "git-token")
+
+	if basic, ok := httpAuth(endpoint).(*http.BasicAuth); !ok || basic.Password != "git-token" {
+		t.Errorf("Expected GIT_TOKEN for a host other than GitHub, got %v", basic)
 	}
 }
 
-func TestBaseBranchWithValidBranch(t *testing.T) {
-	repo, path, _ := createTestRepo(t)
-	repoName := filepath.Base(path)
+func TestRemoteAuthByScheme(t *testing.T) {
+	repo, _, _ := createTestRepo(t)
+	setTestCredentialsEnv(t)
+	t.Setenv("GIT_TOKEN", "token")
 
-	branches, _ := repo.Branches()
+	urls := map[string]string{
+		"https":  "https://example.com/org/repo.git",
+		"ssh":    "git@example.com:org/repo.git",
+		"local":  t.TempDir(),
+		"scheme": "file:///tmp/repo.git",
+	}
 
-	baseBranch, err := findBaseBranch(repoName, branches, defaultBaseBranch)
+	for name, url := range urls {
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{url}}); err != nil {
+			t.Fatalf("Error creating remote %s: %v", name, err)
+		}
+	}
 
-	if err != nil {
-		t.Errorf("baseBranch returned error: %v", err)
+	endpoint := func(name string) *transport.Endpoint {
+		remote, _ := repo.Remote(name)
+		endpoint, err := remoteEndpoint("repo", repo, remote)
+
+		if err != nil {
+			t.Fatalf("Error getting endpoint of remote %s: %v", name, err)
+		}
+
+		return endpoint
 	}
 
-	if baseBranch.Name().Short() != defaultBaseBranch {
-		t.Errorf("Expected base branch: %s", defaultBaseBranch)
+	auth, err := remoteAuth("repo", endpoint("https"), AuthOptions{})
+
+	if basic, ok := auth.(*http.BasicAuth); err != nil || !ok || basic.Password != "token" || basic.Username != tokenUsername {
+		t.Errorf("Expected token basic auth for HTTPS remote, got %v %v", auth, err)
 	}
-}
 
-func TestBaseBranchWithInvalidBranch(t *testing.T) {
-	repo, path, _ := createTestRepo(t)
-	repoName := filepath.Base(path)
+	auth, err = remoteAuth("repo", endpoint("ssh"), AuthOptions{})
 
-	branches, _ := repo.Branches()
+	if keys, ok := auth.(*gitssh.PublicKeysCallback); err != nil || !ok || keys.User != "git" {
+		t.Errorf("Expected public keys auth for SSH remote, got %v %v", auth, err)
+	}
 
-	_, err := findBaseBranch(repoName, branches, "test")
+	if _, err := remoteAuth("repo", endpoint("ssh"), AuthOptions{SSHKeyFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Errorf("Expected error with missing SSH key file")
+	}
 
-	if err == nil {
-		t.Errorf("Expected empty result")
+	for _, name := range []string{"local", "scheme"} {
+		if auth, err := remoteAuth("repo", endpoint(name), AuthOptions{}); auth != nil || err != nil {
+			t.Errorf("Expected no auth for %s remote, got %v %v", name, auth, err)
+		}
 	}
 }
 
@@ -156,12 +1782,14 @@ func TestIsStaleWithStaleBranch(t *testing.T) {
 	branch := createTestBranch(t, repo, staleBranch, hash, time.Now().AddDate(0, 0, -31))
 	repoName := filepath.Base(path)
 
-	staled, err := isStale(repoName, repo, branch, 30)
+	commit, err := lastCommit(repoName, repo, branch)
 
 	if err != nil {
-		t.Errorf("isStale returned error: %v", err)
+		t.Fatalf("lastCommit returned error: %v", err)
 	}
 
+	staled := isStale(commit.Author.When, 30)
+
 	if staled == false {
 		t.Errorf("Expected isStale to be true")
 	}
@@ -173,18 +1801,145 @@ func TestIsStaleWithFreshBranch(t *testing.T) {
 	branch := createTestBranch(t, repo, staleBranch, hash, time.Now())
 	repoName := filepath.Base(path)
 
-	staled, err := isStale(repoName, repo, branch, 30)
+	commit, err := lastCommit(repoName, repo, branch)
 
 	if err != nil {
-		t.Errorf("isStale returned error: %v", err)
+		t.Fatalf("lastCommit returned error: %v", err)
 	}
 
+	staled := isStale(commit.Author.When, 30)
+
 	if staled == true {
 		t.Errorf("Expected isStale to be false")
 	}
 
 }
 
+func TestParseAge(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"30d":                  time.Date(2025, 2, 8, 12, 0, 0, 0, time.UTC),
+		"6w":                   time.Date(2025, 1, 27, 12, 0, 0, 0, time.UTC),
+		"3mo":                  time.Date(2024, 12, 10, 12, 0, 0, 0, time.UTC),
+		"1y":                   time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		"2025-01-01":           time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local),
+		"2025-01-01T08:00:00Z": time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC),
+	}
+
+	for value, expected := range tests {
+		date, err := ParseAge(value, now)
+
+		if err != nil || !date.Equal(expected) {
+			t.Errorf("Expected ParseAge(%q) to be %v, got %v: %v", value, expected, date, err)
+		}
+	}
+
+	for _, value := range []string{"", "30", "6x", "-3d", "01/01/2025"} {
+		if _, err := ParseAge(value, now); err == nil {
+			t.Errorf("Expected ParseAge(%q) to return an error", value)
+		}
+	}
+}
+
+func TestParseAgeWindow(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	month := time.Date(2025, 2, 8, 12, 0, 0, 0, time.UTC)
+	week := time.Date(2025, 3, 3, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		olderThan, newerThan string
+		daysChanged          bool
+		older, newer         time.Time
+		days                 int
+	}{
+		{"", "", false, time.Time{}, time.Time{}, 30},
+		{"30d", "", false, month, time.Time{}, 30},
+		{"30d", "1w", false, month, week, 30},
+		// Alone, newer than includes branches of any age, with days it selects a window
+		{"", "1w", false, time.Time{}, week, 0},
+		{"", "1w", true, time.Time{}, week, 30},
+	}
+
+	for _, test := range tests {
+		older, newer, days, err := ParseAgeWindow(test.olderThan, test.newerThan, 30, test.daysChanged, now)
+
+		if err != nil || !older.Equal(test.older) || !newer.Equal(test.newer) || days != test.days {
+			t.Errorf("Expected window %v %v %d for %+v, got %v %v %d: %v", test.older, test.newer, test.days, test, older, newer, days, err)
+		}
+	}
+
+	if _, _, _, err := ParseAgeWindow("30d", "", 30, true, now); err == nil {
+		t.Errorf("Expected error with both days and older than")
+	}
+
+	if _, _, _, err := ParseAgeWindow("", "soon", 30, false, now); err == nil {
+		t.Errorf("Expected error with invalid newer than")
+	}
+}
+
+func TestSweeperWithAgeWindow(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	now := time.Now()
+	_ = createTestBranch(t, repo, "active", hash, now.AddDate(0, 0, -2))
+	_ = createTestBranch(t, repo, "recent", hash, now.AddDate(0, 0, -20))
+	_ = createTestBranch(t, repo, "old", hash, now.AddDate(0, 0, -90))
+	checkoutBaseBranch(t, repo)
+
+	tests := []struct {
+		staleDays int
+		olderThan time.Time
+		newerThan time.Time
+		expected  []string
+		reasons   []string
+	}{
+		{30, time.Time{}, time.Time{}, []string{"old"}, []string{ReasonStale}},
+		{30, now.AddDate(0, 0, -10), time.Time{}, []string{"old", "recent"}, []string{ReasonStale}},
+		// Newer than alone includes the branches of any age, they are not stale
+		{0, time.Time{}, now.AddDate(0, 0, -3), []string{"active"}, []string{ReasonNewerThan}},
+		{30, now.AddDate(0, 0, -10), now.AddDate(0, 0, -60), []string{"recent"}, []string{ReasonStale, ReasonNewerThan}},
+	}
+
+	for _, test := range tests {
+		options := SweeperOptions{
+			Paths:        []string{path},
+			StaleDays:    test.staleDays,
+			OlderThan:    test.olderThan,
+			NewerThan:    test.newerThan,
+			BaseBranches: []string{"main"},
+		}
+
+		repoBranches, err := Sweeper(options)
+
+		if err != nil {
+			t.Fatalf("Sweeper returned error: %v", err)
+		}
+
+		names := []string{}
+
+		for _, report := range repoBranches {
+			names = append(names, report.BranchName())
+
+			if !slices.Equal(report.Reasons, test.reasons) {
+				t.Errorf("Expected branch %s reasons %v, got %v", report.BranchName(), test.reasons, report.Reasons)
+			}
+		}
+
+		slices.Sort(names)
+
+		if !slices.Equal(names, test.expected) {
+			t.Errorf("Expected branches %v, got %v", test.expected, names)
+		}
+	}
+
+	options := SweeperOptions{Paths: []string{path}, OlderThan: now.AddDate(0, 0, -30), NewerThan: now}
+
+	if _, err := Sweeper(options); err == nil {
+		t.Errorf("Expected error with an empty age window")
+	}
+}
+
 func TestIsMergedWithMergedBranch(t *testing.T) {
 	repo, path, hash := createTestRepo(t)
 	branch := createTestBranch(t, repo, randomName(), hash, time.Now())
@@ -197,7 +1952,7 @@ func TestIsMergedWithMergedBranch(t *testing.T) {
 		t.Fatalf("Error getting base branch reference: %v", err)
 	}
 
-	merged, err := isMerged(repoName, repo, baseBranch, branch)
+	merged, err := newBaseHistory(repo, baseBranch).isMerged(repoName, branch)
 
 	if err != nil {
 		t.Errorf("isMerged returned error: %v", err)
@@ -218,7 +1973,7 @@ func TestIsMergedWithUnmergedBranch(t *testing.T) {
 		t.Fatalf("Error getting base branch reference: %v", err)
 	}
 
-	merged, err := isMerged(repoName, repo, baseBranch, branch)
+	merged, err := newBaseHistory(repo, baseBranch).isMerged(repoName, branch)
 
 	if err != nil {
 		t.Errorf("isMerged returned error: %v", err)
@@ -229,13 +1984,153 @@ func TestIsMergedWithUnmergedBranch(t *testing.T) {
 	}
 }
 
+func TestIsMergedWithBaseAncestor(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	history := createTestHistory(t, repo, hash, 10)
+	baseBranch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(defaultBaseBranch), history[len(history)-1])
+	repoName := filepath.Base(path)
+
+	cache := newBaseHistory(repo, baseBranch)
+
+	for _, hash := range history {
+		branch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(randomName()), hash)
+		merged, err := cache.isMerged(repoName, branch)
+
+		if err != nil {
+			t.Errorf("isMerged returned error: %v", err)
+		}
+
+		if !merged {
+			t.Errorf("Expected commit %s to be merged", hash)
+		}
+	}
+
+	sideBranch := createTestHistory(t, repo, history[3], 1)
+	branch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(randomName()), sideBranch[0])
+
+	if merged, _ := cache.isMerged(repoName, branch); merged {
+		t.Errorf("Expected side branch commit %s not to be merged", sideBranch[0])
+	}
+}
+
+func TestMergedWithSquashMergedBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	repoName := filepath.Base(path)
+	branchName := randomName()
+	_ = createTestBranch(t, repo, branchName, hash, time.Now())
+	commitTestFile(t, repo, "a.txt", "first change\n")
+	commitTestFile(t, repo, "b.txt", "second change\n")
+	branch, _ := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
+
+	// Squash both branch commits into a single base branch commit
+	checkoutBaseBranch(t, repo)
+	writeTestFile(t, repo, "a.txt", "first change\n")
+	commitTestFile(t, repo, "b.txt", "second change\n")
+	baseBranch, _ := repo.Reference(plumbing.NewBranchReferenceName(defaultBaseBranch), true)
+
+	for detection, expected := range map[MergeDetection]MergeDetection{
+		MergeDetectionAncestry: "",
+		MergeDetectionPatchID:  "",
+		MergeDetectionSquash:   MergeDetectionSquash,
+		MergeDetectionAny:      MergeDetectionSquash,
+	} {
+		mergedBy, err := newBaseHistory(repo, baseBranch).merged(repoName, branch, detection)
+
+		if err != nil {
+			t.Errorf("merged returned error: %v", err)
+		}
+
+		if mergedBy != expected {
+			t.Errorf("Expected %s detection to return %q, got %q", detection, expected, mergedBy)
+		}
+	}
+}
+
+func TestMergedWithRebaseMergedBranch(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	repoName := filepath.Base(path)
+	branchName := randomName()
+	_ = createTestBranch(t, repo, branchName, hash, time.Now())
+	commitTestFile(t, repo, "a.txt", "rebased change\n")
+	branch, _ := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
+
+	// Apply the same patch on top of another base branch commit, then change the file again
+	checkoutBaseBranch(t, repo)
+	commitTestFile(t, repo, "other.txt", "other change\n")
+	commitTestFile(t, repo, "a.txt", "rebased change\n")
+	commitTestFile(t, repo, "a.txt", "later change\n")
+	baseBranch, _ := repo.Reference(plumbing.NewBranchReferenceName(defaultBaseBranch), true)
+
+	for detection, expected := range map[MergeDetection]MergeDetection{
+		MergeDetectionAncestry: "",
+		MergeDetectionSquash:   "",
+		MergeDetectionPatchID:  MergeDetectionPatchID,
+		MergeDetectionAny:      MergeDetectionPatchID,
+	} {
+		mergedBy, err := newBaseHistory(repo, baseBranch).merged(repoName, branch, detection)
+
+		if err != nil {
+			t.Errorf("merged returned error: %v", err)
+		}
+
+		if mergedBy != expected {
+			t.Errorf("Expected %s detection to return %q, got %q", detection, expected, mergedBy)
+		}
+	}
+}
+
+func TestMergedWithUnmergedChanges(t *testing.T) {
+	repo, path, hash := createTestRepo(t)
+	repoName := filepath.Base(path)
+	branchName := randomName()
+	_ = createTestBranch(t, repo, branchName, hash, time.Now())
+	commitTestFile(t, repo, "a.txt", "unmerged change\n")
+	branch, _ := repo.Reference(plumbing.NewBranchReferenceName(branchName), true)
+
+	checkoutBaseBranch(t, repo)
+	commitTestFile(t, repo, "a.txt", "another change\n")
+	baseBranch, _ := repo.Reference(plumbing.NewBranchReferenceName(defaultBaseBranch), true)
+
+	cache := newBaseHistory(repo, baseBranch)
+	mergedBy, err := cache.merged(repoName, branch, MergeDetectionAny)
+
+	if err != nil {
+		t.Errorf("merged returned error: %v", err)
+	}
+
+	if mergedBy != "" {
+		t.Errorf("Expected branch not to be merged, got %q", mergedBy)
+	}
+
+	// Both detection modes walked the branch once, the base history since the merge base was walked once as well
+	if len(cache.branches) != 1 || len(cache.patchIDsSinceBase) != 1 {
+		t.Errorf("Expected the branch and base histories to be cached, got %d and %d", len(cache.branches), len(cache.patchIDsSinceBase))
+	}
+
+	unique, mergeBase, err := cache.uniqueCommits(repoName, branch)
+
+	if err != nil || len(unique) != 2 || mergeBase == nil || mergeBase.Hash != hash {
+		t.Errorf("Expected 2 unique commits since %s from the cache, got %d: %v", hash, len(unique), err)
+	}
+}
+
+func TestParseMergeDetection(t *testing.T) {
+	if detection, err := ParseMergeDetection(""); err != nil || detection != MergeDetectionAncestry {
+		t.Errorf("Expected empty merge detection to default to ancestry")
+	}
+
+	if _, err := ParseMergeDetection("rebase"); err == nil {
+		t.Errorf("Expected error for unsupported merge detection")
+	}
+}
+
 func TestDeleteBranch(t *testing.T) {
 	repo, path, hash := createTestRepo(t)
 	branchToBeDeleted := randomName()
 	branch := createTestBranch(t, repo, branchToBeDeleted, hash, time.Now())
 	repoName := filepath.Base(path)
 
-	err := deleteBranch(repoName, repo, branch)
+	err := deleteBranch(repoName, repo, branch, nil)
 	if err != nil {
 		t.Errorf("deleteBranch returned error: %v", err)
 	}
@@ -247,8 +2142,80 @@ func TestDeleteBranch(t *testing.T) {
 
 }
 
-func createTestRepo(t *testing.T) (*git.Repository, string, plumbing.Hash) {
+func BenchmarkIsMerged(b *testing.B) {
+	repo, path, hash := createTestRepo(b)
+	repoName := filepath.Base(path)
+	history := createTestHistory(b, repo, hash, 5000)
+	baseBranch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(defaultBaseBranch), history[len(history)-1])
+	branches := []*plumbing.Reference{}
+
+	// Half of the branches are merged into the base branch, the other half diverge from it
+	for i := range 200 {
+		tip := history[i*len(history)/200]
+
+		if i%2 == 1 {
+			tip = createTestHistory(b, repo, tip, 1)[0]
+		}
+
+		branches = append(branches, plumbing.NewHashReference(plumbing.NewBranchReferenceName(randomName()), tip))
+	}
+
+	b.ResetTimer()
+
+	for range b.N {
+		cache := newBaseHistory(repo, baseBranch)
+
+		for _, branch := range branches {
+			if _, err := cache.isMerged(repoName, branch); err != nil {
+				b.Fatalf("isMerged returned error: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkSweeperMerged(b *testing.B) {
+	repo, path, hash := createTestRepo(b)
+	history := createTestHistory(b, repo, hash, 5000)
+
+	err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(defaultBaseBranch), history[len(history)-1]))
+
+	if err != nil {
+		b.Fatalf("Error moving base branch: %v", err)
+	}
+
+	for i := range 50 {
+		branch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(randomName()), history[i*len(history)/50])
+
+		if err := repo.Storer.SetReference(branch); err != nil {
+			b.Fatalf("Error creating branch: %v", err)
+		}
+	}
+
+	options := SweeperOptions{
+		Paths:        []string{path},
+		StaleDays:    30,
+		Merged:       true,
+		BaseBranches: []string{defaultBaseBranch},
+	}
+
+	b.ResetTimer()
+
+	for range b.N {
+		if _, err := Sweeper(options); err != nil {
+			b.Fatalf("Sweeper returned error: %v", err)
+		}
+	}
+}
+
+func createTestRepo(t testing.TB) (*git.Repository, string, plumbing.Hash) {
 	path := t.TempDir()
+	repo := createTestRepoOnPath(t, path)
+	head, _ := repo.Head()
+
+	return repo, path, head.Hash()
+}
+
+func createTestRepoOnPath(t testing.TB, path string) *git.Repository {
 	defaultBranch := plumbing.NewBranchReferenceName(defaultBaseBranch)
 
 	initOptions := git.PlainInitOptions{
@@ -276,13 +2243,13 @@ func createTestRepo(t *testing.T) (*git.Repository, string, plumbing.Hash) {
 		Author:            &author,
 	}
 
-	hash, err := worktree.Commit(randomName(), &commitOptions)
+	_, err = worktree.Commit(randomName(), &commitOptions)
 
 	if err != nil {
 		t.Errorf("Error creating initial commit: %v", err)
 	}
 
-	return repo, path, hash
+	return repo
 }
 
 func createTestBranch(t *testing.T, repo *git.Repository, branchName string, hash plumbing.Hash, date time.Time) *plumbing.Reference {
@@ -357,9 +2324,157 @@ func mergedBranchWithBase(t *testing.T, repo *git.Repository, branchToMerge *plu
 
 }
 
+// createTestRemote creates a bare repository as the origin remote of repo and pushes the branches to it
+func createTestRemote(t *testing.T, repo *git.Repository, branches ...string) *git.Repository {
+	path := t.TempDir()
+	remote, err := git.PlainInit(path, true)
+
+	if err != nil {
+		t.Fatalf("Error creating remote repository: %v", err)
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{path}}); err != nil {
+		t.Fatalf("Error creating remote: %v", err)
+	}
+
+	refSpecs := []config.RefSpec{}
+
+	for _, branch := range branches {
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("refs/heads/%[1]s:refs/heads/%[1]s", branch)))
+		setTestUpstream(t, repo, branch, branch)
+	}
+
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: refSpecs}); err != nil {
+		t.Fatalf("Error pushing branches to remote: %v", err)
+	}
+
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: "origin"}); err != nil && err != git.NoErrAlreadyUpToDate {
+		t.Fatalf("Error fetching remote: %v", err)
+	}
+
+	return remote
+}
+
+// setTestCredentialsEnv isolates the tests from the user credentials: no token, credential helper or netrc file
+func setTestCredentialsEnv(t *testing.T) {
+	for _, name := range []string{"GIT_TOKEN", "GITHUB_TOKEN", "GITHUB_SERVER_URL"} {
+		t.Setenv(name, "")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+}
+
+// setTestUpstream makes the local branch track the remote branch of origin
+func setTestUpstream(t *testing.T, repo *git.Repository, branch string, remoteBranch string) {
+	cfg, err := repo.Config()
+
+	if err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+
+	cfg.Branches[branch] = &config.Branch{Name: branch, Remote: "origin", Merge: plumbing.NewBranchReferenceName(remoteBranch)}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("Error setting upstream of branch %s: %v", branch, err)
+	}
+}
+
 func randomName() string {
 	seed := time.Now().UTC().UnixNano()
 	nameGenerator := namegenerator.NewNameGenerator(seed)
 
 	return nameGenerator.Generate()
 }
+
+func checkoutBaseBranch(t *testing.T, repo *git.Repository) {
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		t.Error("Error getting worktree")
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(defaultBaseBranch)})
+
+	if err != nil {
+		t.Error("Error checking out base branch")
+	}
+}
+
+// createTestHistory stores a linear history of n commits on top of parent directly in the object storage,
+// which is much faster than committing through the worktree, and returns their hashes oldest first
+func createTestHistory(t testing.TB, repo *git.Repository, parent plumbing.Hash, n int) []plumbing.Hash {
+	parentCommit, err := repo.CommitObject(parent)
+
+	if err != nil {
+		t.Fatalf("Error getting parent commit: %v", err)
+	}
+
+	hashes := []plumbing.Hash{}
+	date := time.Now().AddDate(0, 0, -60)
+
+	for i := range n {
+		signature := object.Signature{
+			Name:  "test",
+			Email: "test@test.com",
+			When:  date.Add(time.Duration(i) * time.Minute),
+		}
+
+		commit := &object.Commit{
+			Author:       signature,
+			Committer:    signature,
+			Message:      fmt.Sprintf("commit %d", i),
+			TreeHash:     parentCommit.TreeHash,
+			ParentHashes: []plumbing.Hash{parent},
+		}
+
+		encoded := repo.Storer.NewEncodedObject()
+
+		if err := commit.Encode(encoded); err != nil {
+			t.Fatalf("Error encoding commit: %v", err)
+		}
+
+		parent, err = repo.Storer.SetEncodedObject(encoded)
+
+		if err != nil {
+			t.Fatalf("Error storing commit: %v", err)
+		}
+
+		hashes = append(hashes, parent)
+	}
+
+	return hashes
+}
+
+func writeTestFile(t *testing.T, repo *git.Repository, name string, content string) {
+	worktree, err := repo.Worktree()
+
+	if err != nil {
+		t.Fatal("Error getting worktree")
+	}
+
+	if err := os.WriteFile(filepath.Join(worktree.Filesystem.Root(), name), []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing file %s: %v", name, err)
+	}
+
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatalf("Error adding file %s: %v", name, err)
+	}
+}
+
+func commitTestFile(t *testing.T, repo *git.Repository, name string, content string) {
+	writeTestFile(t, repo, name, content)
+
+	worktree, _ := repo.Worktree()
+
+	author := object.Signature{
+		Name:  randomName(),
+		Email: randomName() + "@test.com",
+		When:  time.Now(),
+	}
+
+	if _, err := worktree.Commit(randomName(), &git.CommitOptions{Author: &author}); err != nil {
+		t.Fatalf("Error committing file %s: %v", name, err)
+	}
+}
@@ -0,0 +1,203 @@
+package sweeper
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// History returns the journals of the prune runs recorded in the repositories under paths, oldest first
+// discover should match the options of the prune runs so their repositories are found
+func History(paths []string, discover DiscoverOptions) ([]Journal, error) {
+	repoPaths, errs, err := discoverRepositories(paths, discover)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repositories on path: %w", err)
+	}
+
+	history := []Journal{}
+
+	for _, repoPath := range repoPaths {
+		repo, err := openRepository(repoPath)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not open repository on path %s: %w", repoPath, err))
+			continue
+		}
+
+		journals, err := readJournals(repoPath, repo)
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		history = append(history, journals...)
+	}
+
+	// Repositories are discovered in lexical order, keep it for journals of the same run
+	sortJournals(history)
+
+	return history, errors.Join(errs...)
+}
+
+// Undo restores the branches deleted during a prune run in the repositories under paths
+// Local branches are recreated with their upstream configuration and remote branches are pushed again
+// When runID is empty the most recent run that was not restored yet is used
+// auth configures how remote repositories are authenticated when pushing remote branches back
+// and discover how repositories are found, see History
+func Undo(paths []string, runID string, auth AuthOptions, discover DiscoverOptions) ([]BranchReport, error) {
+	history, err := History(paths, discover)
+
+	if history == nil {
+		return nil, err
+	}
+
+	errs := []error{err}
+
+	if runID == "" {
+		for _, journal := range history {
+			if journal.RestoredAt == nil {
+				runID = journal.RunID
+			}
+		}
+
+		if runID == "" {
+			return nil, errors.Join(append(errs, fmt.Errorf("no prune runs to undo"))...)
+		}
+	}
+
+	reports := []BranchReport{}
+	found := false
+
+	for _, journal := range history {
+		if journal.RunID != runID {
+			continue
+		}
+
+		found = true
+
+		if journal.RestoredAt != nil {
+			errs = append(errs, fmt.Errorf("%s run %s was already restored on %s", journal.RepoName, runID, journal.RestoredAt.Format(time.DateTime)))
+			continue
+		}
+
+		restored, err := restoreJournal(journal, auth)
+		reports = append(reports, restored...)
+		errs = append(errs, err)
+	}
+
+	if !found {
+		errs = append(errs, fmt.Errorf("prune run %s not found", runID))
+	}
+
+	return reports, errors.Join(errs...)
+}
+
+// restoreJournal restores every branch recorded in the journal of a repository
+// The journal is marked as restored and the backup references removed once all branches are restored
+func restoreJournal(journal Journal, auth AuthOptions) ([]BranchReport, error) {
+	repo, err := openRepository(journal.RepoPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open repository on path %s: %w", journal.RepoPath, err)
+	}
+
+	reports := []BranchReport{}
+	errs := []error{}
+
+	for _, entry := range journal.Entries {
+		if !entry.deleted() {
+			continue
+		}
+
+		report := journal.report(entry)
+		report.Action = ActionRestored
+		report.Err = restoreEntry(journal.RepoName, repo, entry, auth)
+
+		if report.Err != nil {
+			report.Action = ActionFailed
+			errs = append(errs, report.Err)
+		}
+
+		reports = append(reports, report)
+	}
+
+	if len(errs) > 0 {
+		return reports, errors.Join(errs...)
+	}
+
+	for _, entry := range journal.Entries {
+		for _, name := range []plumbing.ReferenceName{entry.BackupRef, entry.RemoteBackup} {
+			if name == "" {
+				continue
+			}
+
+			if err := repo.Storer.RemoveReference(name); err != nil {
+				errs = append(errs, fmt.Errorf("%s failed to remove backup reference %s: %w", journal.RepoName, name, err))
+			}
+		}
+	}
+
+	restoredAt := time.Now()
+	journal.RestoredAt = &restoredAt
+	errs = append(errs, journal.save(repo))
+
+	return reports, errors.Join(errs...)
+}
+
+// restoreEntry recreates a pruned local branch and pushes the remote branch back if it was deleted
+func restoreEntry(repoName string, repo *git.Repository, entry JournalEntry, auth AuthOptions) error {
+	hash := plumbing.NewHash(entry.Hash)
+
+	if entry.DeletedLocal {
+		branch, err := repo.Reference(entry.Branch, false)
+
+		switch {
+		case err == plumbing.ErrReferenceNotFound:
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(entry.Branch, hash)); err != nil {
+				return fmt.Errorf("%s failed to restore branch %s: %w", repoName, entry.Branch.Short(), err)
+			}
+		case err != nil:
+			return fmt.Errorf("%s failed to get branch %s: %w", repoName, entry.Branch.Short(), err)
+		case branch.Hash() != hash:
+			return fmt.Errorf("%s branch %s was recreated pointing to another commit, not restoring it", repoName, entry.Branch.Short())
+		}
+
+		if entry.UpstreamRemote != "" {
+			upstream := &config.Branch{
+				Name:   entry.Branch.Short(),
+				Remote: entry.UpstreamRemote,
+				Merge:  entry.UpstreamMerge,
+				Rebase: entry.UpstreamRebase,
+			}
+
+			if err := repo.CreateBranch(upstream); err != nil && err != git.ErrBranchExists {
+				return fmt.Errorf("%s failed to restore branch config %s: %w", repoName, entry.Branch.Short(), err)
+			}
+		}
+	}
+
+	if entry.DeletedRemote {
+		// Prefer the remote-tracking state, the remote branch may have pointed to another commit
+		source := entry.BackupRef
+
+		if entry.RemoteBackup != "" {
+			source = entry.RemoteBackup
+		}
+
+		refSpecs := []config.RefSpec{
+			config.RefSpec(source.String() + ":" + entry.RemoteBranch.String()),
+		}
+
+		if err := push(repoName, repo, entry.Remote, refSpecs, auth); err != nil {
+			return fmt.Errorf("%s failed to restore remote branch %s/%s: %w", repoName, entry.Remote, entry.RemoteBranch.Short(), err)
+		}
+	}
+
+	return nil
+}
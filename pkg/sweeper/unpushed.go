@@ -0,0 +1,173 @@
+package sweeper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// SkipUnpushed is the skip reason of branches with commits not reachable from any remote-tracking branch or base branch,
+// the upstream deleted along with a branch doesn't count
+const SkipUnpushed = "unpushed commits"
+
+// pushedHistory caches the commits reachable from the remote-tracking branches and the base branches of a repository,
+// deleting a branch loses every commit that is not part of it
+type pushedHistory struct {
+	repo  *git.Repository
+	bases []*plumbing.Reference
+	// reachable holds the commits reachable from the base branches
+	reachable map[plumbing.Hash]bool
+	// remotes holds for every remote-tracking branch the commits it reaches that no base branch does,
+	// pushed counts the remote-tracking branches reaching each of them
+	remotes map[plumbing.ReferenceName]map[plumbing.Hash]bool
+	pushed  map[plumbing.Hash]int
+}
+
+// newPushedHistory returns a cache for the pushed history, the history is loaded on first use
+func newPushedHistory(repo *git.Repository, bases []*plumbing.Reference) *pushedHistory {
+	return &pushedHistory{
+		repo:  repo,
+		bases: bases,
+	}
+}
+
+// load walks the history of every base branch and remote-tracking branch once, recording every reachable commit
+func (h *pushedHistory) load(repoName string) error {
+	if h.reachable != nil {
+		return nil
+	}
+
+	reachable := map[plumbing.Hash]bool{}
+
+	for _, base := range h.bases {
+		// Commits already recorded were reached from a previous base, along with their history
+		err := h.walk(repoName, base.Hash(), reachable, func(hash plumbing.Hash) {
+			reachable[hash] = true
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	refs, err := h.repo.References()
+
+	if err != nil {
+		return fmt.Errorf("%s failed to get list of references: %w", repoName, err)
+	}
+
+	remotes := map[plumbing.ReferenceName]map[plumbing.Hash]bool{}
+	pushed := map[plumbing.Hash]int{}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(ref.Name().String(), "refs/remotes/") {
+			return nil
+		}
+
+		commits := map[plumbing.Hash]bool{}
+		remotes[ref.Name()] = commits
+
+		return h.walk(repoName, ref.Hash(), reachable, func(hash plumbing.Hash) {
+			commits[hash] = true
+			pushed[hash]++
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s failed to get list of references: %w", repoName, err)
+	}
+
+	h.reachable, h.remotes, h.pushed = reachable, remotes, pushed
+
+	return nil
+}
+
+// walk calls visit for every commit reachable from tip, commits in stop and their history are not walked
+func (h *pushedHistory) walk(repoName string, tip plumbing.Hash, stop map[plumbing.Hash]bool, visit func(plumbing.Hash)) error {
+	if stop[tip] {
+		return nil
+	}
+
+	commit, err := h.repo.CommitObject(tip)
+
+	if err != nil {
+		return fmt.Errorf("%s error getting remote-tracking branch commit: %w", repoName, err)
+	}
+
+	err = object.NewCommitPreorderIter(commit, stop, nil).ForEach(func(commit *object.Commit) error {
+		visit(commit.Hash)
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s remote-tracking branch commits lookup failed: %w", repoName, err)
+	}
+
+	return nil
+}
+
+// isPushed reports whether the commit is reachable from a base branch or a remote-tracking branch other than exclude
+func (h *pushedHistory) isPushed(hash plumbing.Hash, exclude plumbing.ReferenceName) bool {
+	if h.reachable[hash] {
+		return true
+	}
+
+	pushed := h.pushed[hash]
+
+	if h.remotes[exclude][hash] {
+		pushed--
+	}
+
+	return pushed > 0
+}
+
+// unpushedCommits returns the number of commits only reachable from the branch, which are lost if it is deleted
+// exclude is a remote-tracking branch deleted along with the branch, its commits don't count as pushed
+func (h *pushedHistory) unpushedCommits(repoName string, branch *plumbing.Reference, exclude plumbing.ReferenceName) (int, error) {
+	if err := h.load(repoName); err != nil {
+		return 0, err
+	}
+
+	if h.isPushed(branch.Hash(), exclude) {
+		return 0, nil
+	}
+
+	tip, err := h.repo.CommitObject(branch.Hash())
+
+	if err != nil {
+		return 0, fmt.Errorf("%s error getting branch last commit: %w", repoName, err)
+	}
+
+	unpushed := 0
+	seen := map[plumbing.Hash]bool{tip.Hash: true}
+	queue := []*object.Commit{tip}
+
+	for len(queue) > 0 {
+		commit := queue[0]
+		queue = queue[1:]
+
+		// The history of a pushed commit is pushed along with it
+		if h.isPushed(commit.Hash, exclude) {
+			continue
+		}
+
+		unpushed++
+
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			if !seen[parent.Hash] {
+				seen[parent.Hash] = true
+				queue = append(queue, parent)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return 0, fmt.Errorf("%s error getting branch commits log: %w", repoName, err)
+		}
+	}
+
+	return unpushed, nil
+}
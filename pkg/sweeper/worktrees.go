@@ -0,0 +1,73 @@
+package sweeper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// SkipCheckedOut is the skip reason of branches checked out in the main working tree or a linked worktree
+const SkipCheckedOut = "checked out"
+
+// gitDir returns the path of the repository git directory, e.g. /path/to/repo/.git
+// Repositories opened from a linked worktree return the common git directory, see commonGitDir
+func gitDir(repo *git.Repository) (string, error) {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+
+	if !ok {
+		return "", fmt.Errorf("repository is not stored on disk")
+	}
+
+	return commonGitDir(storage.Filesystem().Root()), nil
+}
+
+// checkedOutBranches returns the branches checked out in the main working tree and in every linked worktree
+// Linked worktrees keep their HEAD in .git/worktrees/<name>/HEAD, the main working tree HEAD is read as well
+// when the repository was opened from a linked worktree, and the HEAD of a bare repository counts as checked out
+func checkedOutBranches(repoName string, repo *git.Repository) (map[plumbing.ReferenceName]bool, error) {
+	checkedOut := map[plumbing.ReferenceName]bool{}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, fmt.Errorf("%s failed to get HEAD: %w", repoName, err)
+	}
+
+	if head != nil && head.Type() == plumbing.SymbolicReference {
+		checkedOut[head.Target()] = true
+	}
+
+	dir, err := gitDir(repo)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to get git directory: %w", repoName, err)
+	}
+
+	heads, err := filepath.Glob(filepath.Join(dir, "worktrees", "*", "HEAD"))
+
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to list worktrees: %w", repoName, err)
+	}
+
+	heads = append(heads, filepath.Join(dir, "HEAD"))
+
+	for _, headPath := range heads {
+		content, err := os.ReadFile(headPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to read worktree HEAD %s: %w", repoName, headPath, err)
+		}
+
+		// A detached HEAD contains a hash instead of a branch reference
+		if target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: "); ok {
+			checkedOut[plumbing.ReferenceName(target)] = true
+		}
+	}
+
+	return checkedOut, nil
+}